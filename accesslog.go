@@ -0,0 +1,312 @@
+package cola
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Access log formats
+const (
+	// AccessLogCombined Apache combined log format followed by
+	// the latency in milliseconds, the request body size and the request id
+	AccessLogCombined = "combined"
+	// AccessLogJSON one json object per line
+	AccessLogJSON = "json"
+)
+
+// AccessLogConfig config of the AccessLog middleware
+type AccessLogConfig struct {
+	// AccessLogCombined, AccessLogJSON or a template of tags, like
+	// "${time} ${ip} ${method} ${route} ${status} ${latency}".
+	//
+	// Tags: time, ip, method, path, route, query, protocol, host, status,
+	// latency, latency_ms, bytes_in, bytes_out, referer, user_agent, request_id.
+	// Quotes, backslashes and control characters of the values are escaped.
+	//
+	// Optional. Default value AccessLogCombined.
+	Format string `json:"format"`
+
+	// Output of the access log, separate from Log.
+	// Use a log.RotateWriter to rotate the file.
+	// Optional. Default value os.Stdout.
+	Output io.Writer `json:"-"`
+
+	// Part of the requests logged, from 0 to 1.
+	// 5xx responses are always logged.
+	// Optional. Default value 1.
+	SampleRate float64 `json:"sample_rate"`
+
+	// Paths not logged, like "/health".
+	// Optional. Default value nil.
+	SkipPaths []string `json:"skip_paths"`
+
+	// Skip the request when it returns true, called after the handlers.
+	// Optional. Default value nil.
+	Skip func(*Ctx) bool `json:"-"`
+}
+
+// accessRecord values of a logged request
+type accessRecord struct {
+	time      time.Time
+	ip        string
+	method    string
+	path      string
+	route     string
+	query     string
+	protocol  string
+	host      string
+	status    int
+	latency   time.Duration
+	bytesIn   int
+	bytesOut  int // -1 for streamed bodies, logged as "-"
+	referer   string
+	userAgent string
+	requestID string
+}
+
+// AccessLog returns the access log middleware.
+// The route pattern is logged instead of the raw path, "-" when no route matched.
+// A panicking handler is logged with status 500, the size of a streamed body as "-".
+//
+//	w, _ := log.NewRotateWriter("./logs/access.log", log.RotateConfig{Daily: true})
+//	app.Use(cola.AccessLog(cola.AccessLogConfig{
+//		Output:    w,
+//		SkipPaths: []string{"/health"},
+//	}))
+func AccessLog(config ...AccessLogConfig) Hand {
+	cfg := AccessLogConfig{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.Format == "" {
+		cfg.Format = AccessLogCombined
+	}
+	if cfg.Output == nil {
+		cfg.Output = os.Stdout
+	}
+	if cfg.SampleRate <= 0 || cfg.SampleRate > 1 {
+		cfg.SampleRate = 1
+	}
+	skip := make(map[string]struct{}, len(cfg.SkipPaths))
+	for _, p := range cfg.SkipPaths {
+		skip[p] = struct{}{}
+	}
+
+	var format func(*strings.Builder, *accessRecord)
+	switch cfg.Format {
+	case AccessLogCombined:
+		format = formatCombined
+	case AccessLogJSON:
+		format = formatJSON
+	default:
+		format = parseAccessTemplate(cfg.Format)
+	}
+	logRequest := accessLogger(&cfg, format)
+
+	return func(c *Ctx) {
+		if _, ok := skip[c.path]; ok {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		// log from a deferred function, the panics are recovered by the core after the chain
+		completed := false
+		defer func() {
+			status := c.Response.StatusCode()
+			if !completed {
+				status = StatusInternalServerError
+			}
+			logRequest(c, start, status)
+		}()
+		c.Next()
+		completed = true
+	}
+}
+
+// accessLogger returns the function writing the log line of a request
+func accessLogger(cfg *AccessLogConfig, format func(*strings.Builder, *accessRecord)) func(*Ctx, time.Time, int) {
+	var mu sync.Mutex
+	return func(c *Ctx, start time.Time, status int) {
+		if cfg.Skip != nil && cfg.Skip(c) ||
+			cfg.SampleRate < 1 && status < StatusInternalServerError && rand.Float64() >= cfg.SampleRate {
+			return
+		}
+
+		r := accessRecord{
+			time:      start,
+			ip:        c.IP(),
+			method:    c.method,
+			path:      c.path,
+			route:     "-",
+			query:     BytesToString(c.QueryArgs().QueryString()),
+			protocol:  "HTTP/1.0",
+			host:      c.Hostname(),
+			status:    status,
+			latency:   time.Since(start),
+			bytesIn:   len(c.Request.Body()),
+			referer:   c.Get(HeaderReferer),
+			userAgent: c.Get(HeaderUserAgent),
+			requestID: c.RequestID(),
+		}
+		if c.Request.Header.IsHTTP11() {
+			r.protocol = "HTTP/1.1"
+		}
+		if c.matched && c.route != nil {
+			r.route = c.route.Path
+		}
+		// Body reads a body stream, the size of streams is unknown
+		if c.Response.IsBodyStream() {
+			r.bytesOut = -1
+		} else {
+			r.bytesOut = len(c.Response.Body())
+		}
+
+		var b strings.Builder
+		format(&b, &r)
+		b.WriteByte('\n')
+		mu.Lock()
+		_, _ = io.WriteString(cfg.Output, b.String())
+		mu.Unlock()
+	}
+}
+
+// formatCombined 127.0.0.1 - - [02/Jan/2006:15:04:05 -0700] "GET /user/:id HTTP/1.1" 200 42 "referer" "agent" 0.512 0 1
+func formatCombined(b *strings.Builder, r *accessRecord) {
+	b.WriteString(dash(escapeLog(r.ip)))
+	b.WriteString(" - - [")
+	b.WriteString(r.time.Format("02/Jan/2006:15:04:05 -0700"))
+	b.WriteString(`] "`)
+	b.WriteString(escapeLog(r.method))
+	b.WriteByte(' ')
+	b.WriteString(escapeLog(r.route))
+	b.WriteByte(' ')
+	b.WriteString(escapeLog(r.protocol))
+	b.WriteString(`" `)
+	b.WriteString(strconv.Itoa(r.status))
+	b.WriteByte(' ')
+	b.WriteString(bytesOut(r))
+	b.WriteString(` "`)
+	b.WriteString(dash(escapeLog(r.referer)))
+	b.WriteString(`" "`)
+	b.WriteString(dash(escapeLog(r.userAgent)))
+	b.WriteString(`" `)
+	b.WriteString(strconv.FormatFloat(float64(r.latency)/float64(time.Millisecond), 'f', 3, 64))
+	b.WriteByte(' ')
+	b.WriteString(strconv.Itoa(r.bytesIn))
+	b.WriteByte(' ')
+	b.WriteString(dash(escapeLog(r.requestID)))
+}
+
+func formatJSON(b *strings.Builder, r *accessRecord) {
+	v := struct {
+		Time      string  `json:"time"`
+		RequestID string  `json:"request_id"`
+		IP        string  `json:"ip"`
+		Method    string  `json:"method"`
+		Route     string  `json:"route"`
+		Protocol  string  `json:"protocol"`
+		Status    int     `json:"status"`
+		Latency   float64 `json:"latency_ms"`
+		BytesIn   int     `json:"bytes_in"`
+		BytesOut  *int    `json:"bytes_out"`
+		Referer   string  `json:"referer"`
+		UserAgent string  `json:"user_agent"`
+	}{
+		r.time.Format(time.RFC3339Nano), r.requestID, r.ip, r.method, r.route, r.protocol, r.status,
+		float64(r.latency) / float64(time.Millisecond), r.bytesIn, nil, r.referer, r.userAgent,
+	}
+	// null for streamed bodies
+	if r.bytesOut >= 0 {
+		v.BytesOut = &r.bytesOut
+	}
+	raw, _ := json.Marshal(v)
+	b.Write(raw)
+}
+
+// bytesOut returns the response body size, "-" for streamed bodies
+func bytesOut(r *accessRecord) string {
+	if r.bytesOut < 0 {
+		return "-"
+	}
+	return strconv.Itoa(r.bytesOut)
+}
+
+// parseAccessTemplate split the template in text and ${tag} parts once
+func parseAccessTemplate(tpl string) func(*strings.Builder, *accessRecord) {
+	var parts []func(*strings.Builder, *accessRecord)
+	for tpl != "" {
+		i := strings.Index(tpl, "${")
+		j := -1
+		if i != -1 {
+			j = strings.IndexByte(tpl[i:], '}')
+		}
+		if i == -1 || j == -1 {
+			text := tpl
+			parts = append(parts, func(b *strings.Builder, r *accessRecord) { b.WriteString(text) })
+			break
+		}
+		if i > 0 {
+			text := tpl[:i]
+			parts = append(parts, func(b *strings.Builder, r *accessRecord) { b.WriteString(text) })
+		}
+		tag := tpl[i+2 : i+j]
+		fn, ok := accessTags[tag]
+		if !ok {
+			panic("cola: unknown access log tag ${" + tag + "}")
+		}
+		parts = append(parts, func(b *strings.Builder, r *accessRecord) { b.WriteString(fn(r)) })
+		tpl = tpl[i+j+1:]
+	}
+	return func(b *strings.Builder, r *accessRecord) {
+		for _, part := range parts {
+			part(b, r)
+		}
+	}
+}
+
+var accessTags = map[string]func(*accessRecord) string{
+	"time":     func(r *accessRecord) string { return r.time.Format(time.RFC3339) },
+	"ip":       func(r *accessRecord) string { return escapeLog(r.ip) },
+	"method":   func(r *accessRecord) string { return escapeLog(r.method) },
+	"path":     func(r *accessRecord) string { return escapeLog(r.path) },
+	"route":    func(r *accessRecord) string { return escapeLog(r.route) },
+	"query":    func(r *accessRecord) string { return escapeLog(r.query) },
+	"protocol": func(r *accessRecord) string { return escapeLog(r.protocol) },
+	"host":     func(r *accessRecord) string { return escapeLog(r.host) },
+	"status":   func(r *accessRecord) string { return strconv.Itoa(r.status) },
+	"latency":  func(r *accessRecord) string { return r.latency.String() },
+	"latency_ms": func(r *accessRecord) string {
+		return strconv.FormatFloat(float64(r.latency)/float64(time.Millisecond), 'f', 3, 64)
+	},
+	"bytes_in":   func(r *accessRecord) string { return strconv.Itoa(r.bytesIn) },
+	"bytes_out":  bytesOut,
+	"referer":    func(r *accessRecord) string { return escapeLog(r.referer) },
+	"user_agent": func(r *accessRecord) string { return escapeLog(r.userAgent) },
+	"request_id": func(r *accessRecord) string { return escapeLog(r.requestID) },
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escapeLog escapes the quotes, backslashes, control characters and
+// invalid utf-8 of a client value like strconv.Quote, so it can not end
+// the quoted field or fake a log line
+func escapeLog(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c >= 0x7f || c == '"' || c == '\\' {
+			q := strconv.Quote(s)
+			return q[1 : len(q)-1]
+		}
+	}
+	return s
+}
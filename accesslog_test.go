@@ -0,0 +1,163 @@
+package cola
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer a bytes.Buffer safe for the access log and the test
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestAccessLog(t *testing.T) {
+	out := new(syncBuffer)
+	app := New()
+	app.Use(AccessLog(AccessLogConfig{
+		Format:    "${method} ${route} ${status} ${bytes_out}",
+		Output:    out,
+		SkipPaths: []string{"/health"},
+	}))
+	app.Add(MethodGet, "/user/:id", func(c *Ctx) { c.SendString("user") })
+	app.Add(MethodGet, "/health", func(c *Ctx) { c.SendString("ok") })
+	app.Add(MethodGet, "/panic", func(c *Ctx) { panic("boom") })
+	app.Add(MethodGet, "/stream", func(c *Ctx) {
+		c.Response.SetBodyStreamWriter(func(w *bufio.Writer) { w.WriteString("streamed") })
+	})
+	tc := NewTestClient(app)
+
+	tc.Get("/user/1").Expect(StatusOK)
+	tc.Get("/health").Expect(StatusOK)
+	tc.Get("/panic").Expect(StatusInternalServerError)
+	tc.Get("/stream").Expect(StatusOK)
+	tc.Get("/missing").Expect(StatusNotFound)
+
+	want := "GET /user/:id 200 4\n" +
+		"GET /panic 500 0\n" +
+		"GET /stream 200 -\n" +
+		"GET - 404 "
+	if got := out.String(); !strings.HasPrefix(got, want) {
+		t.Fatalf("log = %q, want prefix %q", got, want)
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	out := new(syncBuffer)
+	app := New()
+	app.Use(AccessLog(AccessLogConfig{Format: AccessLogJSON, Output: out}))
+	app.Add(MethodGet, "/stream", func(c *Ctx) {
+		c.Response.SetBodyStreamWriter(func(w *bufio.Writer) { w.WriteString("streamed") })
+	})
+	if err := NewTestClient(app).Get("/stream").Expect(StatusOK).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	var line Map
+	if err := json.Unmarshal([]byte(out.String()), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line["route"] != "/stream" || line["status"] != float64(StatusOK) {
+		t.Fatalf("log = %v", line)
+	}
+	if v, ok := line["bytes_out"]; !ok || v != nil {
+		t.Fatalf("bytes_out = %v, want null", v)
+	}
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	out := new(syncBuffer)
+	app := New()
+	app.Use(AccessLog(AccessLogConfig{Output: out}))
+	app.Add(MethodPost, "/save/:id", func(c *Ctx) { c.SendString("saved") })
+	err := NewTestClient(app).Post("/save/1").Query("a", "1").Body("data").
+		Header(HeaderReferer, "https://a.com/").Header(HeaderUserAgent, "test").
+		Header(HeaderXRequestID, "rid-1").Expect(StatusOK).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		// the route, not the path, keeps ids and query strings out of the log
+		`"POST /save/:id HTTP/1.1" 200 5 "https://a.com/" "test" `,
+		" 4 rid-1\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestAccessLogEscape(t *testing.T) {
+	for _, tt := range []struct {
+		format, want string
+	}{
+		{AccessLogCombined, `"a\\\" \"b" "c\\\x1b[31m" `},
+		{"${referer} ${user_agent}", `a\\\" \"b c\\\x1b[31m` + "\n"},
+	} {
+		out := new(syncBuffer)
+		app := New()
+		app.Use(AccessLog(AccessLogConfig{Output: out, Format: tt.format}))
+		app.Add(MethodGet, "/", func(c *Ctx) {})
+		err := NewTestClient(app).Get("/").
+			Header(HeaderReferer, `a\" "b`).Header(HeaderUserAgent, "c\\\x1b[31m").Err()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String(); !strings.Contains(got, tt.want) {
+			t.Errorf("%q: log = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+	for in, want := range map[string]string{
+		"ok":       "ok",
+		"a\r\nb":   `a\r\nb`,
+		"\x1b[31m": `\x1b[31m`,
+		"\xff":     `\xff`,
+		"é":        "é",
+		`"q" \`:    `\"q\" \\`,
+	} {
+		if got := escapeLog(in); got != want {
+			t.Errorf("escapeLog(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAccessLogSkip(t *testing.T) {
+	out := new(syncBuffer)
+	app := New()
+	app.Use(AccessLog(AccessLogConfig{
+		Format:     "${path} ${status}",
+		Output:     out,
+		SampleRate: 0.000001,
+		Skip:       func(c *Ctx) bool { return c.Path() == "/skip" },
+	}))
+	app.Add(MethodGet, "/ok", func(c *Ctx) { c.SendString("ok") })
+	app.Add(MethodGet, "/fail", func(c *Ctx) { c.Status(StatusBadGateway) })
+	app.Add(MethodGet, "/skip", func(c *Ctx) { c.Status(StatusBadGateway) })
+	tc := NewTestClient(app)
+
+	for _, path := range []string{"/ok", "/fail", "/skip"} {
+		tc.Get(path).Err()
+	}
+	// 5xx responses are logged whatever the sample rate
+	if got := out.String(); got != "/fail 502\n" {
+		t.Fatalf("log = %q, want %q", got, "/fail 502\n")
+	}
+}
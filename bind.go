@@ -0,0 +1,197 @@
+package cola
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/schema"
+)
+
+// Bind fills out from the whole request.
+//
+// The body is decoded by ReadBody, then the fields tagged with
+// query, header, cookie and param are set from the query string,
+// headers, cookies and route params, the later source wins.
+// Only explicitly tagged fields are set from these sources,
+// so a query argument can not overwrite a body field.
+//
+//	type UserQuery struct {
+//		ID    int    `param:"id"`
+//		Page  int    `query:"page"`
+//		Token string `header:"X-Token"`
+//		Sid   string `cookie:"sid"`
+//		Name  string `json:"name" form:"name"`
+//	}
+//
+// Decode errors are returned as a 400 *Error,
+// then out is checked by Validate which returns a *ValidationError.
+func (c *Ctx) Bind(out interface{}) error {
+	if len(c.Request.Body()) > 0 {
+		if err := c.ReadBody(out); err != nil {
+			return badRequest(err)
+		}
+	}
+	if err := bindValues("query", out, c.queryValues(), true); err != nil {
+		return err
+	}
+	if err := bindValues("header", out, c.headerValues(), true); err != nil {
+		return err
+	}
+	if err := bindValues("cookie", out, c.cookieValues(), true); err != nil {
+		return err
+	}
+	if err := bindValues("param", out, c.paramValues(), true); err != nil {
+		return err
+	}
+	return Validate(out)
+}
+
+// BindQuery fills out from the query string with the query tag,
+// untagged fields are matched by name
+//
+//	type ListQuery struct {
+//		Page  int      `query:"page"`
+//		Limit int      `query:"limit"`
+//		Tags  []string `query:"tag"` // ?tag=a&tag=b
+//	}
+func (c *Ctx) BindQuery(out interface{}) error {
+	return bindValues("query", out, c.queryValues(), false)
+}
+
+// BindParams fills out from the route params with the param tag,
+// untagged fields are matched by name
+func (c *Ctx) BindParams(out interface{}) error {
+	return bindValues("param", out, c.paramValues(), false)
+}
+
+// BindHeader fills out from the request headers with the header tag,
+// untagged fields are matched by name
+func (c *Ctx) BindHeader(out interface{}) error {
+	return bindValues("header", out, c.headerValues(), false)
+}
+
+// BindCookie fills out from the request cookies with the cookie tag,
+// untagged fields are matched by name
+func (c *Ctx) BindCookie(out interface{}) error {
+	return bindValues("cookie", out, c.cookieValues(), false)
+}
+
+func (c *Ctx) queryValues() map[string][]string {
+	data := make(map[string][]string)
+	c.QueryArgs().VisitAll(func(key, val []byte) {
+		k := string(key)
+		data[k] = append(data[k], string(val))
+	})
+	return data
+}
+
+func (c *Ctx) headerValues() map[string][]string {
+	data := make(map[string][]string)
+	c.Request.Header.VisitAll(func(key, val []byte) {
+		k := string(key)
+		data[k] = append(data[k], string(val))
+	})
+	return data
+}
+
+func (c *Ctx) cookieValues() map[string][]string {
+	data := make(map[string][]string)
+	c.Request.Header.VisitAllCookie(func(key, val []byte) {
+		k := string(key)
+		data[k] = append(data[k], string(val))
+	})
+	return data
+}
+
+func (c *Ctx) paramValues() map[string][]string {
+	data := make(map[string][]string)
+	if c.route == nil {
+		return data
+	}
+	for i, key := range c.route.Params {
+		if i < len(c.values) && len(c.values[i]) > 0 {
+			data[key] = []string{CopyString(c.values[i])}
+		}
+	}
+	return data
+}
+
+// bindValues decode data into out with the decoder of tag,
+// when tagged is true the keys without a field tagged with tag are dropped
+func bindValues(tag string, out interface{}, data map[string][]string, tagged bool) error {
+	if tagged {
+		fields := taggedFields(reflect.TypeOf(out), tag)
+		for k := range data {
+			if _, ok := fields[strings.ToLower(k)]; !ok {
+				delete(data, k)
+			}
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return badRequest(decode(tag, out, data))
+}
+
+// decode data into out with the pooled decoder of tag
+func decode(tag string, out interface{}, data map[string][]string) error {
+	decoder := decoderPool[tag].Get().(*schema.Decoder)
+	defer decoderPool[tag].Put(decoder)
+	return decoder.Decode(out, data)
+}
+
+// badRequest turns a decode error into a 400 *Error
+func badRequest(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	return NewError(StatusBadRequest, err.Error())
+}
+
+type taggedKey struct {
+	t   reflect.Type
+	tag string
+}
+
+// taggedCache caches the lower case names of the tagged fields of a type
+var taggedCache sync.Map
+
+// taggedFields returns the lower case names of the fields of t tagged with tag,
+// embedded structs are included
+func taggedFields(t reflect.Type, tag string) map[string]struct{} {
+	key := taggedKey{t, tag}
+	if fields, ok := taggedCache.Load(key); ok {
+		return fields.(map[string]struct{})
+	}
+	fields := make(map[string]struct{})
+	collectTagged(t, tag, fields)
+	taggedCache.Store(key, fields)
+	return fields
+}
+
+func collectTagged(t reflect.Type, tag string, fields map[string]struct{}) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get(tag), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			if f.Anonymous {
+				collectTagged(f.Type, tag, fields)
+			}
+			continue
+		}
+		fields[strings.ToLower(name)] = struct{}{}
+	}
+}
@@ -0,0 +1,78 @@
+package cola
+
+import (
+	"strconv"
+	"testing"
+)
+
+type bindUser struct {
+	ID    int      `param:"id"`
+	Page  int      `query:"page"`
+	Tags  []string `query:"tag"`
+	Token string   `header:"X-Token"`
+	Sid   string   `cookie:"sid"`
+	Name  string   `json:"name" form:"name"`
+}
+
+func TestBind(t *testing.T) {
+	app := New()
+	app.Add(MethodPost, "/user/:id", func(c *Ctx) error {
+		var in bindUser
+		if err := c.Bind(&in); err != nil {
+			return err
+		}
+		return c.JSON(in)
+	})
+	tc := NewTestClient(app)
+
+	var got bindUser
+	err := tc.Post("/user/7").Query("page", "2").Query("tag", "a").Query("tag", "b").
+		Query("name", "query").Header("X-Token", "tk").Cookie("sid", "s1").
+		JSONBody(Map{"name": "bob"}).Expect(StatusOK).JSON(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bindUser{ID: 7, Page: 2, Tags: []string{"a", "b"}, Token: "tk", Sid: "s1", Name: "bob"}
+	if got.ID != want.ID || got.Page != want.Page || len(got.Tags) != 2 || got.Token != want.Token ||
+		got.Sid != want.Sid || got.Name != want.Name {
+		t.Fatalf("Bind() = %+v, want %+v", got, want)
+	}
+
+	got = bindUser{}
+	if err = tc.Post("/user/7").Field("name", "form").Expect(StatusOK).JSON(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "form" {
+		t.Fatalf("Bind() form name = %q, want form", got.Name)
+	}
+
+	for _, r := range []*TestRequest{
+		tc.Post("/user/x"),
+		tc.Post("/user/1").Header(HeaderContentType, MIMEApplicationJSON).Body("{bad"),
+	} {
+		if err = r.Expect(StatusBadRequest).Err(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestBindQuery(t *testing.T) {
+	app := New()
+	app.Add(MethodGet, "/search", func(c *Ctx) error {
+		var in struct {
+			Page int
+			Name string `query:"n"`
+		}
+		if err := c.BindQuery(&in); err != nil {
+			return err
+		}
+		return c.SendString(in.Name + ":" + strconv.Itoa(in.Page))
+	})
+	body, err := NewTestClient(app).Get("/search").Query("page", "3").Query("n", "z").Expect(StatusOK).String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "z:3" {
+		t.Fatalf("BindQuery() = %q, want z:3", body)
+	}
+}
@@ -0,0 +1,299 @@
+package cola
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheConfig config of the response cache
+type CacheConfig struct {
+	// Time a response is cached.
+	// Optional. Default value 1 * time.Minute.
+	Expiration time.Duration `json:"expiration"`
+
+	// KeyGenerator returns the cache key of the request,
+	// e.g. add the theme or the user id from Vars.
+	// Optional. Default value method, host, path and query, "GET example.com/user?id=1".
+	KeyGenerator func(*Ctx) string `json:"-"`
+
+	// Storage of the responses.
+	// Optional. Default value NewMemoryStorage().
+	Storage Storage `json:"-"`
+
+	// Next skips the cache when it returns true.
+	// Optional. Default value nil.
+	Next func(*Ctx) bool `json:"-"`
+}
+
+// Cache server side cache of GET and HEAD responses.
+//
+// Only 200 responses are cached, responses setting cookies,
+// streamed responses and responses with Cache-Control no-store, no-cache
+// or private are not. Concurrent misses of a key run the handler once.
+// A response with a Vary header is stored for the values of those request headers,
+// e.g. a compressed and an identity body when the Compress middleware runs after the cache.
+// The X-Cache header is HIT or MISS.
+//
+//	cache := cola.NewCache(cola.CacheConfig{Expiration: 5 * time.Minute})
+//	app.Use(cache.Hand)
+//	// after an update
+//	cache.Invalidate("/posts")
+type Cache struct {
+	cfg CacheConfig
+
+	mu    sync.Mutex
+	calls map[string]chan struct{} // running misses
+	keys  map[string]cacheKey      // stored keys, used by Invalidate
+	prune time.Time
+}
+
+type cacheKey struct {
+	path    string
+	expires time.Time
+	vary    bool // the Vary header names of a key, not a response
+}
+
+// cacheEntry stored response
+type cacheEntry struct {
+	Status  int
+	Headers [][2]string
+	Body    []byte
+	Created time.Time
+}
+
+// NewCache create a response cache, use Hand as middleware
+func NewCache(config ...CacheConfig) *Cache {
+	cfg := CacheConfig{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.Expiration <= 0 {
+		cfg.Expiration = time.Minute
+	}
+	if cfg.KeyGenerator == nil {
+		cfg.KeyGenerator = func(c *Ctx) string {
+			return c.method + " " + c.Hostname() + c.path + "?" + BytesToString(c.QueryArgs().QueryString())
+		}
+	}
+	if cfg.Storage == nil {
+		cfg.Storage = NewMemoryStorage()
+	}
+	return &Cache{
+		cfg:   cfg,
+		calls: make(map[string]chan struct{}),
+		keys:  make(map[string]cacheKey),
+	}
+}
+
+// Hand the cache middleware
+func (ca *Cache) Hand(c *Ctx) {
+	if ca.cfg.Next != nil && ca.cfg.Next(c) ||
+		c.method != MethodGet && c.method != MethodHead ||
+		strings.Contains(c.Get(HeaderCacheControl), "no-store") {
+		c.Next()
+		return
+	}
+	// copy the key, it may refer to the request buffers
+	key := string([]byte(ca.cfg.KeyGenerator(c)))
+	if ca.send(c, ca.variant(c, key)) {
+		return
+	}
+
+	// Wait for a running miss of the key
+	ca.mu.Lock()
+	if done, ok := ca.calls[key]; ok {
+		ca.mu.Unlock()
+		<-done
+		if ca.send(c, ca.variant(c, key)) {
+			return
+		}
+		c.Set(HeaderXCache, "MISS")
+		c.Next()
+		return
+	}
+	done := make(chan struct{})
+	ca.calls[key] = done
+	ca.mu.Unlock()
+	defer func() {
+		ca.mu.Lock()
+		delete(ca.calls, key)
+		ca.mu.Unlock()
+		close(done)
+	}()
+
+	c.Set(HeaderXCache, "MISS")
+	c.Next()
+	if ca.cacheable(c) {
+		ca.store(c, key)
+	}
+}
+
+// Invalidate removes the responses whose key or request path starts with prefix,
+// it returns the number of removed responses
+func (ca *Cache) Invalidate(prefix string) int {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	n := 0
+	now := time.Now()
+	for key, k := range ca.keys {
+		if strings.HasPrefix(key, prefix) || strings.HasPrefix(k.path, prefix) {
+			if err := ca.cfg.Storage.Delete("cache:" + key); err != nil {
+				Log.Error("Cache: %v", err)
+				continue
+			}
+			delete(ca.keys, key)
+			if !k.vary && now.Before(k.expires) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Reset removes all cached responses
+func (ca *Cache) Reset() {
+	ca.Invalidate("")
+}
+
+// variant returns the key of the response stored for the request headers
+// named by the Vary header of the response of key
+func (ca *Cache) variant(c *Ctx, key string) string {
+	vary, err := ca.cfg.Storage.Get("cache:vary:" + key)
+	if err != nil {
+		Log.Error("Cache: %v", err)
+		return key
+	}
+	if vary == nil {
+		return key
+	}
+	return key + varyKey(c, string(vary))
+}
+
+// varyKey returns the values of the request headers named by vary
+func varyKey(c *Ctx, vary string) string {
+	b := new(strings.Builder)
+	for _, name := range strings.Split(vary, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			b.WriteString("\n" + ToLower(name) + ": " + c.Get(name))
+		}
+	}
+	return b.String()
+}
+
+// send the stored response of key
+func (ca *Cache) send(c *Ctx, key string) bool {
+	raw, err := ca.cfg.Storage.Get("cache:" + key)
+	if err != nil {
+		Log.Error("Cache: %v", err)
+		return false
+	}
+	if raw == nil {
+		return false
+	}
+	var e cacheEntry
+	if err = gob.NewDecoder(bytes.NewReader(raw)).Decode(&e); err != nil {
+		Log.Error("Cache: %v", err)
+		return false
+	}
+	c.Status(e.Status)
+	for i, h := range e.Headers {
+		// keep every value of a repeated header
+		repeated := false
+		for _, prev := range e.Headers[:i] {
+			if prev[0] == h[0] {
+				repeated = true
+				break
+			}
+		}
+		if repeated {
+			c.Response.Header.Add(h[0], h[1])
+		} else {
+			c.Response.Header.Set(h[0], h[1])
+		}
+	}
+	c.Response.SetBody(e.Body)
+	c.Set(HeaderAge, strconv.Itoa(int(time.Since(e.Created)/time.Second)))
+	c.Set(HeaderXCache, "HIT")
+	return true
+}
+
+// cacheable reports whether the response of c can be stored
+func (ca *Cache) cacheable(c *Ctx) bool {
+	resp := &c.Response
+	if resp.StatusCode() != StatusOK || resp.IsBodyStream() {
+		return false
+	}
+	cc := ToLower(BytesToString(resp.Header.Peek(HeaderCacheControl)))
+	if strings.Contains(cc, "no-store") || strings.Contains(cc, "no-cache") || strings.Contains(cc, "private") {
+		return false
+	}
+	if strings.Contains(BytesToString(resp.Header.Peek(HeaderVary)), "*") {
+		return false
+	}
+	cookie := false
+	resp.Header.VisitAllCookie(func(k, v []byte) {
+		cookie = true
+	})
+	return !cookie
+}
+
+// store the response of c
+func (ca *Cache) store(c *Ctx, key string) {
+	e := cacheEntry{
+		Status:  c.Response.StatusCode(),
+		Body:    c.Response.Body(),
+		Created: time.Now(),
+	}
+	c.Response.Header.VisitAll(func(k, v []byte) {
+		switch BytesToString(k) {
+		case HeaderDate, HeaderContentLength, HeaderServer, HeaderXCache, HeaderSetCookie:
+			return
+		}
+		e.Headers = append(e.Headers, [2]string{string(k), string(v)})
+	})
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(&e); err != nil {
+		Log.Error("Cache: %v", err)
+		return
+	}
+
+	// the response is stored for the values of the Vary request headers
+	vary := string(c.Response.Header.Peek(HeaderVary))
+	entryKey := key
+	var err error
+	if vary != "" {
+		entryKey += varyKey(c, vary)
+		err = ca.cfg.Storage.Set("cache:vary:"+key, []byte(vary), ca.cfg.Expiration)
+	} else {
+		err = ca.cfg.Storage.Delete("cache:vary:" + key)
+	}
+	if err == nil {
+		err = ca.cfg.Storage.Set("cache:"+entryKey, buf.Bytes(), ca.cfg.Expiration)
+	}
+	if err != nil {
+		Log.Error("Cache: %v", err)
+		return
+	}
+
+	ca.mu.Lock()
+	now := time.Now()
+	path := string([]byte(c.path))
+	ca.keys[entryKey] = cacheKey{path: path, expires: now.Add(ca.cfg.Expiration)}
+	if vary != "" {
+		ca.keys["vary:"+key] = cacheKey{path: path, expires: now.Add(ca.cfg.Expiration), vary: true}
+	}
+	// forget the expired keys once per Expiration
+	if now.Sub(ca.prune) > ca.cfg.Expiration {
+		ca.prune = now
+		for k, v := range ca.keys {
+			if now.After(v.expires) {
+				delete(ca.keys, k)
+			}
+		}
+	}
+	ca.mu.Unlock()
+}
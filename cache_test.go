@@ -0,0 +1,133 @@
+package cola
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	app := New()
+	cache := NewCache(CacheConfig{Expiration: 100 * time.Millisecond})
+	app.Use(cache.Hand)
+	var runs int32
+	app.Add(MethodGet, "/posts/:id", func(c *Ctx) {
+		atomic.AddInt32(&runs, 1)
+		time.Sleep(20 * time.Millisecond)
+		c.Set("X-Custom", "v")
+		c.JSON(Map{"id": c.Params("id")})
+	})
+	app.Add(MethodGet, "/private", func(c *Ctx) {
+		c.Set(HeaderCacheControl, "private")
+		c.SendString("p")
+	})
+	app.Add(MethodGet, "/cookie", func(c *Ctx) {
+		c.Cookie(&Cookie{Name: "a", Value: "b"})
+		c.SendString("c")
+	})
+	tc := NewTestClient(app)
+
+	// concurrent misses run the handler once
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tc.Get("/posts/1").Expect(StatusOK).ExpectHeader("X-Custom", "v").
+				ExpectHeader(HeaderContentType, MIMEApplicationJSON).Err(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Fatalf("handler ran %d times, want 1", n)
+	}
+	body, err := tc.Get("/posts/1").ExpectHeader(HeaderXCache, "HIT").String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != `{"id":"1"}` {
+		t.Fatalf("body = %q", body)
+	}
+
+	if n := cache.Invalidate("/posts"); n != 1 {
+		t.Fatalf("Invalidate() = %d, want 1", n)
+	}
+	for _, tt := range []struct {
+		req   *TestRequest
+		cache string
+	}{
+		{tc.Get("/posts/1"), "MISS"},
+		{tc.Get("/posts/1").Header(HeaderCacheControl, "no-store"), ""},
+		{tc.Get("/private"), "MISS"},
+		{tc.Get("/private"), "MISS"},
+		{tc.Get("/cookie"), "MISS"},
+		{tc.Get("/cookie"), "MISS"},
+	} {
+		if err = tt.req.ExpectHeader(HeaderXCache, tt.cache).Err(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if err = tc.Get("/posts/1").ExpectHeader(HeaderXCache, "MISS").Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	app := New()
+	cache := NewCache()
+	app.Use(cache.Hand)
+	app.Use(Compress(CompressConfig{MinLength: 1}))
+	body := strings.Repeat("cola ", 100)
+	app.Add(MethodGet, "/", func(c *Ctx) {
+		c.SendString(body)
+	})
+	tc := NewTestClient(app)
+
+	if err := tc.Get("/").Header(HeaderAcceptEncoding, "br").
+		Expect(StatusOK).ExpectHeader(HeaderContentEncoding, "br").ExpectHeader(HeaderXCache, "MISS").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.Get("/").Header(HeaderAcceptEncoding, "br").
+		ExpectHeader(HeaderContentEncoding, "br").ExpectHeader(HeaderXCache, "HIT").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// an identity client never gets the compressed body
+	for _, cache := range []string{"MISS", "HIT"} {
+		got, err := tc.Get("/").ExpectHeader(HeaderContentEncoding, "").ExpectHeader(HeaderXCache, cache).String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != body {
+			t.Fatalf("body = %q, want %q", got, body)
+		}
+	}
+}
+
+func TestCacheRepeatedHeaders(t *testing.T) {
+	app := New()
+	cache := NewCache()
+	app.Use(cache.Hand)
+	app.Add(MethodGet, "/", func(c *Ctx) {
+		c.Response.Header.Add(HeaderLink, "</a.css>; rel=preload")
+		c.Response.Header.Add(HeaderLink, "</b.js>; rel=preload")
+		c.SendString("ok")
+	})
+	tc := NewTestClient(app)
+
+	for _, cache := range []string{"MISS", "HIT"} {
+		resp, err := tc.Get("/").ExpectHeader(HeaderXCache, cache).Response()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if links := resp.Header.Values(HeaderLink); len(links) != 2 {
+			t.Fatalf("%s: Link = %q, want 2 values", cache, links)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package cola
+
+import (
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Compression encodings
+const (
+	EncodingBrotli  = "br"
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// CompressConfig config of the Compress middleware
+type CompressConfig struct {
+	// Encodings offered to the client, the first wins on equal q-values.
+	// Optional. Default value []string{"br", "gzip", "deflate"}.
+	Encodings []string `json:"encodings"`
+
+	// Compression levels, see fasthttp.CompressBrotli* and fasthttp.Compress*.
+	// Optional. Default value fasthttp.CompressBrotliDefaultCompression (4)
+	// and fasthttp.CompressDefaultCompression (6).
+	BrotliLevel  int `json:"brotli_level"`
+	GzipLevel    int `json:"gzip_level"`
+	DeflateLevel int `json:"deflate_level"`
+
+	// Minimum body size to compress.
+	// Optional. Default value 1024.
+	MinLength int `json:"min_length"`
+
+	// Content types to compress, a type ending with "/" matches the prefix.
+	// Optional. Default value text, json, javascript, xml, yaml and svg.
+	ContentTypes []string `json:"content_types"`
+
+	// Next skips the middleware when it returns true.
+	// Optional. Default value nil.
+	Next func(*Ctx) bool `json:"-"`
+}
+
+var defaultCompressTypes = []string{
+	"text/",
+	MIMEApplicationJSON,
+	MIMEApplicationJavaScript,
+	"application/x-javascript",
+	MIMEApplicationXML,
+	MIMEApplicationYAML,
+	"application/x-yaml",
+	"image/svg+xml",
+}
+
+// Compress returns the middleware compressing the response body
+// with the best encoding of the Accept-Encoding header.
+// Streamed responses like SSE, bodies already encoded and small bodies are sent as is.
+// The ETag of a compressed body is weak.
+//
+//	app.Use(cola.Compress(cola.CompressConfig{MinLength: 512}))
+func Compress(config ...CompressConfig) Hand {
+	cfg := CompressConfig{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if len(cfg.Encodings) == 0 {
+		cfg.Encodings = []string{EncodingBrotli, EncodingGzip, EncodingDeflate}
+	}
+	if cfg.BrotliLevel == 0 {
+		cfg.BrotliLevel = fasthttp.CompressBrotliDefaultCompression
+	}
+	if cfg.GzipLevel == 0 {
+		cfg.GzipLevel = fasthttp.CompressDefaultCompression
+	}
+	if cfg.DeflateLevel == 0 {
+		cfg.DeflateLevel = fasthttp.CompressDefaultCompression
+	}
+	if cfg.MinLength <= 0 {
+		cfg.MinLength = 1024
+	}
+	if len(cfg.ContentTypes) == 0 {
+		cfg.ContentTypes = defaultCompressTypes
+	}
+	for _, enc := range cfg.Encodings {
+		switch enc {
+		case EncodingBrotli, EncodingGzip, EncodingDeflate:
+		default:
+			panic("cola: unknown compress encoding " + enc)
+		}
+	}
+
+	return func(c *Ctx) {
+		if cfg.Next != nil && cfg.Next(c) {
+			c.Next()
+			return
+		}
+		c.Next()
+
+		resp := &c.Response
+		if c.method == MethodHead || resp.IsBodyStream() ||
+			len(resp.Header.Peek(HeaderContentEncoding)) > 0 ||
+			!cfg.compressible(BytesToString(resp.Header.ContentType())) {
+			return
+		}
+		// The representation depends on Accept-Encoding from here on
+		c.Append(HeaderVary, HeaderAcceptEncoding)
+
+		body := resp.Body()
+		if len(body) < cfg.MinLength ||
+			strings.Contains(BytesToString(resp.Header.Peek(HeaderCacheControl)), "no-transform") ||
+			c.Get(HeaderAcceptEncoding) == "" {
+			return
+		}
+
+		var dst []byte
+		enc := c.AcceptsEncodings(cfg.Encodings...)
+		switch enc {
+		case EncodingBrotli:
+			dst = fasthttp.AppendBrotliBytesLevel(nil, body, cfg.BrotliLevel)
+		case EncodingGzip:
+			dst = fasthttp.AppendGzipBytesLevel(nil, body, cfg.GzipLevel)
+		case EncodingDeflate:
+			dst = fasthttp.AppendDeflateBytesLevel(nil, body, cfg.DeflateLevel)
+		default:
+			return
+		}
+		resp.SetBodyRaw(dst)
+		resp.Header.Set(HeaderContentEncoding, enc)
+
+		// A ETag set by the handler is for the identity representation
+		if etag := BytesToString(resp.Header.Peek(HeaderETag)); etag != "" && !strings.HasPrefix(etag, "W/") {
+			resp.Header.Set(HeaderETag, "W/"+etag)
+		}
+	}
+}
+
+// compressible reports whether the content type is in ContentTypes
+func (cfg *CompressConfig) compressible(contentType string) bool {
+	if i := strings.IndexByte(contentType, ';'); i != -1 {
+		contentType = contentType[:i]
+	}
+	contentType = ToLower(strings.TrimSpace(contentType))
+	if contentType == "" {
+		return false
+	}
+	for _, t := range cfg.ContentTypes {
+		if t == contentType || strings.HasSuffix(t, "/") && strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package cola
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestCompress(t *testing.T) {
+	big := strings.Repeat("hello world ", 200)
+	app := New(&Options{ETag: true})
+	app.Use(Compress())
+	app.Add(MethodGet, "/big", func(c *Ctx) { c.SendString(big) })
+	app.Add(MethodGet, "/small", func(c *Ctx) { c.SendString("hi") })
+	app.Add(MethodGet, "/png", func(c *Ctx) {
+		c.Set(HeaderContentType, "image/png")
+		c.SendString(big)
+	})
+	app.Add(MethodGet, "/sse", func(c *Ctx) error {
+		return c.SSE(func(s *SSEStream) error { return s.Data(big) })
+	})
+	tc := NewTestClient(app)
+
+	for _, tt := range []struct{ accept, encoding string }{
+		{"gzip, br;q=0.5", "gzip"},
+		{"br", "br"},
+		{"deflate;q=0.9, gzip;q=0.1", "deflate"},
+		{"identity", ""},
+		{"", ""},
+		{"gzip;q=0", ""},
+	} {
+		req := tc.Get("/big").Header(HeaderAcceptEncoding, tt.accept).Expect(StatusOK).
+			ExpectHeader(HeaderContentEncoding, tt.encoding).ExpectHeader(HeaderVary, HeaderAcceptEncoding)
+		body, err := req.Bytes()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		resp, _ := req.Response()
+		etag := resp.Header.Get(HeaderETag)
+		if weak := strings.HasPrefix(etag, "W/"); weak != (tt.encoding != "") {
+			t.Errorf("Accept-Encoding %q: ETag = %q", tt.accept, etag)
+		}
+		switch tt.encoding {
+		case "":
+			if string(body) != big {
+				t.Errorf("Accept-Encoding %q: body changed", tt.accept)
+			}
+		case "gzip":
+			if out, err := fasthttp.AppendGunzipBytes(nil, body); err != nil || string(out) != big {
+				t.Errorf("Accept-Encoding %q: gunzip = %d bytes, %v", tt.accept, len(out), err)
+			}
+		default:
+			if len(body) >= len(big) {
+				t.Errorf("Accept-Encoding %q: %d bytes not compressed", tt.accept, len(body))
+			}
+		}
+	}
+
+	resp, err := tc.Get("/big").Header(HeaderAcceptEncoding, "gzip").Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tc.Get("/big").Header(HeaderAcceptEncoding, "gzip").
+		Header(HeaderIfNoneMatch, resp.Header.Get(HeaderETag)).Expect(StatusNotModified).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/small", "/png", "/sse"} {
+		if err = tc.Get(path).Header(HeaderAcceptEncoding, "gzip").
+			ExpectHeader(HeaderContentEncoding, "").Err(); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package cola
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Route parameter constraints
+//
+// e.g:
+//
+//	/user/:id<int>
+//	/file/:id<uid>
+//	/tag/:name<alpha;minLen(2);maxLen(16)>?
+//	/post/:slug<regex([a-z0-9-]+)>
+const (
+	constraintInt    = "int"    // integer number
+	constraintUint   = "uint"   // unsigned integer number
+	constraintAlpha  = "alpha"  // letters only
+	constraintUUID   = "uuid"   // 8-4-4-4-12 hexadecimal uuid
+	constraintUID    = "uid"    // 12 chars github.com/xs23933/uid
+	constraintRegex  = "regex"  // regular expression, must match the whole value
+	constraintMinLen = "minLen" // minimum length in characters
+	constraintMaxLen = "maxLen" // maximum length in characters
+	constraintLen    = "len"    // exact length in characters
+)
+
+// constraint of a route parameter
+type constraint struct {
+	ID    string         // name of the constraint
+	Data  string         // data in the brackets, e.g. 3 of minLen(3)
+	n     int            // parsed length for the length constraints
+	regex *regexp.Regexp // compiled regex for the regex constraint
+}
+
+// match check if the value satisfies the constraint
+func (c *constraint) match(value string) bool {
+	switch c.ID {
+	case constraintInt:
+		_, err := strconv.Atoi(value)
+		return err == nil
+	case constraintUint:
+		_, err := strconv.ParseUint(value, 10, 0)
+		return err == nil
+	case constraintAlpha:
+		return isAlpha(value)
+	case constraintUUID:
+		return isUUID(value)
+	case constraintUID:
+		return isUID(value)
+	case constraintRegex:
+		return c.regex.MatchString(value)
+	case constraintMinLen:
+		return utf8.RuneCountInString(value) >= c.n
+	case constraintMaxLen:
+		return utf8.RuneCountInString(value) <= c.n
+	case constraintLen:
+		return utf8.RuneCountInString(value) == c.n
+	}
+	return false
+}
+
+// matchConstraints check if the value satisfies all constraints of the segment
+func (seg *routeSegment) matchConstraints(value string) bool {
+	for _, c := range seg.Constraints {
+		if !c.match(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// findConstraintEnd returns the position of the closing '>' of the constraints
+// starting with '<', brackets and escaped characters of regular expressions are skipped
+func findConstraintEnd(pattern string) int {
+	depth := 0
+	for i := 1; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case paramConstraintDataStart:
+			depth++
+		case paramConstraintDataEnd:
+			depth--
+		case paramConstraintEnd:
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// toLowerRoute lowercase the route pattern, the parameter constraints keep their case
+func toLowerRoute(pattern string) string {
+	res := []byte(pattern)
+	for i := 0; i < len(res); i++ {
+		if res[i] == paramConstraintStart {
+			if end := findConstraintEnd(pattern[i:]); end != -1 {
+				i += end
+				continue
+			}
+		}
+		res[i] = toLowerTable[res[i]]
+	}
+	return BytesToString(res)
+}
+
+// parseConstraints parse the constraints between '<' and '>', panics on unknown constraints
+func parseConstraints(pattern string) []*constraint {
+	var constraints []*constraint
+	start, depth := 0, 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case paramConstraintDataStart:
+			depth++
+		case paramConstraintDataEnd:
+			depth--
+		case paramConstraintSeparator:
+			if depth == 0 {
+				if part := pattern[start:i]; part != "" {
+					constraints = append(constraints, parseConstraint(part))
+				}
+				start = i + 1
+			}
+		}
+	}
+	if part := pattern[start:]; part != "" {
+		constraints = append(constraints, parseConstraint(part))
+	}
+	return constraints
+}
+
+// parseConstraint parse a single constraint like minLen(3)
+func parseConstraint(part string) *constraint {
+	c := &constraint{ID: part}
+	if i := findNextCharsetPosition(part, []byte{paramConstraintDataStart}); i != -1 {
+		if part[len(part)-1] != paramConstraintDataEnd {
+			panic(fmt.Sprintf("parseRoute: missing %q in constraint %s", paramConstraintDataEnd, part))
+		}
+		c.ID, c.Data = part[:i], part[i+1:len(part)-1]
+	}
+
+	var err error
+	switch c.ID {
+	case constraintInt, constraintUint, constraintAlpha, constraintUUID, constraintUID:
+	case constraintRegex:
+		c.regex, err = regexp.Compile("^(?:" + c.Data + ")$")
+	case constraintMinLen, constraintMaxLen, constraintLen:
+		c.n, err = strconv.Atoi(c.Data)
+	default:
+		err = fmt.Errorf("unknown constraint")
+	}
+	if err != nil {
+		panic(fmt.Sprintf("parseRoute: constraint %s: %v", part, err))
+	}
+	return c
+}
+
+// isUUID check the 8-4-4-4-12 hexadecimal uuid format
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHex(s[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isAlpha reports whether s contains only letters
+func isAlpha(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isUID check the format of github.com/xs23933/uid, 12 letters or digits
+func isUID(s string) bool {
+	if len(s) != 12 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
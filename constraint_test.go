@@ -0,0 +1,63 @@
+package cola
+
+import (
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+// serve runs the request of path through the handlers of app
+func serve(app *Core, path string) (int, string) {
+	fctx := new(fasthttp.RequestCtx)
+	fctx.Request.SetRequestURI(path)
+	app.handleRequest(fctx)
+	return fctx.Response.StatusCode(), string(fctx.Response.Body())
+}
+
+func TestRouteConstraints(t *testing.T) {
+	app := New()
+	route := func(name string) HandErr {
+		return func(c *Ctx) error {
+			return c.SendString(name + ":" + c.Params("id"))
+		}
+	}
+	app.Add(MethodGet, "/u/:id<int>", route("int"))
+	app.Add(MethodGet, "/u/:id<uid>", route("uid"))
+	app.Add(MethodGet, "/u/:id<regex(A[b-z]+)>", route("regex"))
+	app.Add(MethodGet, "/u/:id<alpha;minLen(2);maxLen(4)>", route("alpha"))
+	app.Add(MethodGet, "/o/:id<int>?", route("optional"))
+	app.Add(MethodGet, "/s/:id<uuid>", route("uuid"))
+	app.buildTree()
+
+	for _, tt := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/u/12", StatusOK, "int:12"},
+		{"/u/ABCDEFGHIJ12", StatusOK, "uid:ABCDEFGHIJ12"},
+		{"/u/Abc", StatusOK, "regex:Abc"},
+		{"/u/abc", StatusOK, "alpha:abc"},
+		{"/u/abcdef", StatusNotFound, ""},
+		{"/u/a", StatusNotFound, ""},
+		{"/o", StatusOK, "optional:"},
+		{"/o/5", StatusOK, "optional:5"},
+		{"/o/x", StatusNotFound, ""},
+		{"/s/123e4567-e89b-12d3-a456-426614174000", StatusOK, "uuid:123e4567-e89b-12d3-a456-426614174000"},
+		{"/s/123e4567", StatusNotFound, ""},
+	} {
+		status, body := serve(app, tt.path)
+		if status != tt.status || tt.status == StatusOK && body != tt.body {
+			t.Errorf("GET %s = %d %q, want %d %q", tt.path, status, body, tt.status, tt.body)
+		}
+	}
+}
+
+func TestRouteUnknownConstraint(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Add() did not panic on an unknown constraint")
+		}
+	}()
+	New().Add(MethodGet, "/u/:id<nope>", func(*Ctx) {})
+}
@@ -1,37 +1,71 @@
 package cola
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"reflect"
-	"runtime"
 	"runtime/debug"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/valyala/fasthttp"
-	"github.com/valyala/fasthttp/reuseport"
 	"github.com/xs23933/cola/log"
+	"github.com/xs23933/cola/session"
 )
 
 // Hand Handler
 type Hand func(*Ctx)
 
+// HandErr Handler which returns an error,
+// a non nil error is passed to Options.ErrorHandler
+type HandErr func(*Ctx) error
+
+// Hand convert to Hand, so it can be used where a Hand is required
+func (h HandErr) Hand() Hand {
+	return func(c *Ctx) {
+		if err := h(c); err != nil {
+			c.Core.handleError(c, err)
+		}
+	}
+}
+
 // Options Global options
 type Options struct {
 	Prefork bool
 
+	// Directory of the log file <binary>.log, prefork children write <binary>.<n>.log.
+	// The file is reopened on SIGUSR1, see Core.ReopenLog.
+	//
+	// Default: "", log to stdout
 	LogPath string
 
+	// Rotation and retention of the log file in LogPath.
+	//
+	// Default: no rotation
+	LogRotate log.RotateConfig `json:"log_rotate"`
+
+	// Format of Log, "text", "json" or "logfmt".
+	// The colors of the text format are off when not writing to a terminal.
+	//
+	// Default: "text"
+	LogFormat string `json:"log_format"`
+
 	Config interface{}
 
+	// UseCheck register a OPTIONS /check route answering 204
+	//
+	// Deprecated: OPTIONS requests are answered automatically from the
+	// route table, see DisableAutoOptions, and the CORS middleware
+	// answers browser preflight requests.
 	UseCheck bool
 
 	Layout string
@@ -39,6 +73,45 @@ type Options struct {
 	// Debug Default false
 	Debug bool
 
+	// ErrorHandler is executed when a handler returns an error
+	// or no route matches the request.
+	// Only the first error of a request is passed to it.
+	//
+	// Default: DefaultErrorHandler
+	ErrorHandler ErrorHandler `json:"-"`
+
+	// When set to true, requests with a method not registered for a existing
+	// path get a 404 instead of 405 Method Not Allowed with an Allow header.
+	//
+	// Default: false
+	DisableMethodNotAllowed bool `json:"disable_method_not_allowed"`
+
+	// When set to true, OPTIONS requests are no longer answered automatically
+	// with 204 and an Allow header built from the registered routes.
+	// A registered OPTIONS route always takes precedence.
+	//
+	// Default: false
+	DisableAutoOptions bool `json:"disable_auto_options"`
+
+	// OnPanic is called when a handler panics, with the recovered value
+	// and the stack trace. The panic itself is turned into a 500 *Error
+	// and passed to the ErrorHandler.
+	//
+	// Default: nil
+	OnPanic func(*Ctx, interface{}, []byte) `json:"-"`
+
+	// OnPrefork is called by the prefork master when a child process starts or exits,
+	// the status of all children is returned by Core.PreforkStatus.
+	//
+	// Default: nil
+	OnPrefork func(PreforkChild) `json:"-"`
+
+	// Session manager used by Ctx.Session, see the session package
+	// for the memory, file and gorm stores.
+	//
+	// Default: session.New() memory store, created on first use
+	Session *session.Manager `json:"-"`
+
 	Views    Views
 	viewRoot string
 
@@ -102,6 +175,17 @@ type Options struct {
 	// Default: 4096
 	WriteBufferSize int `json:"write_buffer_size"`
 
+	// The maximum amount of time Engine waits for open connections
+	// to finish when shutting down on a signal.
+	//
+	// Default: 10 * time.Second
+	ShutdownTimeout time.Duration `json:"shutdown_timeout"`
+
+	// The maximum amount of time Engine waits for the Exit hook of each module.
+	//
+	// Default: 5 * time.Second
+	ExitTimeout time.Duration `json:"exit_timeout"`
+
 	// CompressedFileSuffix adds suffix to the original file name and
 	// tries saving the resulting compressed file under the new file name.
 	//
@@ -116,11 +200,38 @@ type Core struct {
 	pool sync.Pool
 	// Route stack divided by HTTP methods
 	stack [][]*Route
-	// Route stack divided by HTTP methods and route prefixes
-	treeStack []map[string][]*Route
+	// Radix tree of the route stack divided by HTTP methods, a []*node
+	treeStack atomic.Value
 	mutex     sync.Mutex
 	// Amount of registered routes
 	routesCount int
+	// Amount of registered routes when the tree was built
+	treeCount int
+	// 1 when routes were added after the tree was built, accessed atomically
+	treeStale uint32
+	// Named routes for reverse url generation
+	names map[string]*Route
+	// Last registered route, named by Name
+	lastRoute *Route
+	// Lifecycle hooks
+	onStartup  []func() error
+	onShutdown []func() error
+	// Shutdown can be called concurrently by signals and the prefork supervisor
+	drainOnce sync.Once
+	hookOnce  sync.Once
+	drained   chan struct{}
+	drainErr  error
+	stopped   chan struct{} // closed after the OnShutdown hooks
+	// Prefork master process supervisor
+	supervisor *supervisor
+	// Signals are handled by an Engine, not by the prefork master and children
+	engineSignals bool
+	// Create the default session manager once, Options.Session is not set
+	// so requests without a session do not create it
+	sessionOnce    sync.Once
+	defaultSession atomic.Value // *session.Manager
+	// Log file of Options.LogPath
+	logWriter *log.RotateWriter
 }
 
 // Serve start cola
@@ -151,6 +262,17 @@ func (c *Core) Serve(args ...interface{}) error {
 		addr = ":" + addr
 	}
 
+	c.ensureTree()
+
+	// the prefork master only supervises, the hooks run in the children
+	if !c.Prefork || isChild() {
+		for _, fn := range c.onStartup {
+			if err = fn(); err != nil {
+				return err
+			}
+		}
+	}
+
 	if c.Prefork {
 		return c.prefork(addr, tc)
 	}
@@ -166,23 +288,105 @@ func (c *Core) Serve(args ...interface{}) error {
 	return c.Server.Serve(ln)
 }
 
-// Use register a other plugin middware module TODO:
+// OnStartup add hooks which run in Serve before listening,
+// a hook returning an error stops Serve.
+// With Prefork the hooks run in every child, not in the master.
+func (c *Core) OnStartup(fn ...func() error) *Core {
+	c.onStartup = append(c.onStartup, fn...)
+	return c
+}
+
+// OnShutdown add hooks which run in Shutdown after the connections are drained,
+// the hooks run in reverse registration order.
+// With Prefork the hooks run in every child, not in the master.
+func (c *Core) OnShutdown(fn ...func() error) *Core {
+	c.onShutdown = append(c.onShutdown, fn...)
+	return c
+}
+
+// Shutdown gracefully shuts down the server without interrupting active connections.
+// It waits for the open connections to finish until ctx is done,
+// then runs the OnShutdown hooks. Serve returns nil as soon as Shutdown is called.
+//
+// The prefork master sends SIGTERM to the children and waits for them instead.
+// Shutdown can be called more than once, the server is drained and the hooks run once.
+func (c *Core) Shutdown(ctx context.Context) (err error) {
+	c.drainOnce.Do(func() {
+		c.drained = make(chan struct{})
+		go func() {
+			if c.supervisor != nil {
+				c.drainErr = c.supervisor.shutdown(ctx)
+			} else {
+				c.drainErr = c.Server.Shutdown()
+			}
+			close(c.drained)
+		}()
+	})
+	select {
+	case <-c.drained:
+		err = c.drainErr
+	case <-ctx.Done():
+		err = ctx.Err()
+		Log.Warn("Shutdown: %v, connections still open\n", err)
+	}
+	c.hookOnce.Do(func() {
+		// the hooks run in the prefork children, not in the master
+		if c.supervisor == nil {
+			for i := len(c.onShutdown) - 1; i >= 0; i-- {
+				if e := c.onShutdown[i](); e != nil {
+					Log.Error("Shutdown hook: %v\n", e)
+				}
+			}
+		}
+		close(c.stopped)
+	})
+	return err
+}
+
+// Restart replace the prefork children one by one, so a new binary on disk
+// is picked up without downtime. It does nothing outside the prefork master.
+func (c *Core) Restart() {
+	if c.supervisor != nil {
+		go c.supervisor.restart()
+	}
+}
+
+// ReopenLog reopen the log file of Options.LogPath,
+// used after the file was moved by an external tool like logrotate.
+// The prefork master forwards the call to the children with SIGUSR1.
+func (c *Core) ReopenLog() error {
+	if c.supervisor != nil {
+		c.supervisor.signal(syscall.SIGUSR1)
+	}
+	if c.logWriter == nil {
+		return nil
+	}
+	return c.logWriter.Reopen()
+}
+
+// Use register a other plugin middware module
+//
+// args support a string path prefix, func(*Ctx) or func(*Ctx) error middleware
+// and reflected Handler structs
 func (c *Core) Use(args ...interface{}) *Core {
 	path := ""
 	var handlers []Hand
 	skip := false
 	for _, arg := range args {
-		switch a := arg.(type) {
-		case string:
+		if a, ok := arg.(string); ok {
 			path = a
-		case func(*Ctx):
-			handlers = append(handlers, a)
-		case handle:
+			continue
+		}
+		if a, ok := arg.(handle); ok {
 			skip = true
 			c.buildHandles(a)
-		default:
-			Log.Error("Use not support %v\n", a)
+			continue
+		}
+		if fn, ok := toHand(arg); ok {
+			handlers = append(handlers, fn)
+			continue
 		}
+		Log.Error("Use not support %v\n", arg)
 	}
 	if skip {
 		return c
@@ -192,7 +396,14 @@ func (c *Core) Use(args ...interface{}) *Core {
 	return c
 }
 
-func (c *Core) buildHandles(h handle) {
+// handlerShapes the accepted shapes of the reflected handler methods
+const handlerShapes = "methods named after an HTTP method must be func(*cola.Ctx), func(*cola.Ctx) error, " +
+	"func(*cola.Ctx, *In) (Out, error), func(*cola.Ctx, *In) error or func(*cola.Ctx) (Out, error)"
+
+// buildHandles register the reflected methods of the handler,
+// when registered on a group the routes get the group prefix and middleware.
+// Methods named after an HTTP method with an unsupported shape are logged and skipped.
+func (c *Core) buildHandles(h handle, g ...*Group) {
 	h.Core(c)
 	h.Init() // call init
 	// register routers
@@ -201,15 +412,42 @@ func (c *Core) buildHandles(h handle) {
 	methodCount := refCtl.NumMethod()
 	valFn := reflect.ValueOf(h)
 	prefix := h.Prefix()
-	c.pushMethod(methodUse, prefix, h.Preload) // Register Global preload
+	var chain []Hand
+	if len(g) > 0 {
+		// Preload only runs for the routes of the handler inside a group
+		prefix = joinPath(g[0].prefix, prefix)
+		chain = g[0].chain(h.Preload)
+	} else {
+		c.pushMethod(methodUse, prefix, h.Preload) // Register Global preload
+	}
 	for i := 0; i < methodCount; i++ {
 		m := refCtl.Method(i)
 		name := toNamer(m.Name)
-		if fn, ok := (valFn.Method(i).Interface()).(func(*Ctx)); ok {
+		// WsChat(*cola.WSConn) upgrades GET /chat
+		if fn, ok := valFn.Method(i).Interface().(func(*WSConn)); ok && strings.HasPrefix(name, "ws") {
+			name = fixURI(prefix, name, "ws")
+			route := c.pushMethod(MethodGet, name, appendHands(chain, wsHand(fn))...)
+			c.setName(route, h.HandName()+"."+m.Name)
+			h.PushPath(MethodGet, name)
+			continue
+		}
+		if strings.HasPrefix(name, "ws") {
+			Log.Warn("Handler: %s.%s not registered, Ws methods must be func(*cola.WSConn)\n", h.HandName(), m.Name)
+			continue
+		}
+		if fn, ok := toHand(valFn.Method(i).Interface()); !ok {
+			for _, method := range Methods {
+				if strings.HasPrefix(name, ToLower(method)) {
+					Log.Warn("Handler: %s.%s not registered, %s\n", h.HandName(), m.Name, handlerShapes)
+					break
+				}
+			}
+		} else {
 			for _, method := range Methods {
 				if strings.HasPrefix(name, ToLower(method)) {
 					name = fixURI(prefix, name, method)
-					c.pushMethod(method, name, fn)
+					route := c.pushMethod(method, name, appendHands(chain, fn)...)
+					c.setName(route, h.HandName()+"."+m.Name)
 					h.PushPath(method, name)
 				}
 			}
@@ -218,11 +456,79 @@ func (c *Core) buildHandles(h handle) {
 }
 
 // Add add some method.
-func (c *Core) Add(method, path string, handlers ...Hand) {
-	c.pushMethod(method, path, handlers...)
+//
+// handlers support func(*Ctx) and func(*Ctx) error
+func (c *Core) Add(method, path string, handlers ...interface{}) *Core {
+	c.pushMethod(method, path, toHands(path, handlers)...)
+	return c
+}
+
+// Name set the name of the last registered route, used by URL
+//
+// e.g: app.Add("GET", "/user/:id", getUser).Name("user")
+func (c *Core) Name(name string) *Core {
+	if c.lastRoute != nil {
+		c.setName(c.lastRoute, name)
+	}
+	return c
+}
+
+func (c *Core) setName(route *Route, name string) {
+	if prev, ok := c.names[name]; ok && prev != route {
+		Log.Warn("Name: route name %s already used by %s\n", name, prev.Path)
+	}
+	route.Name = name
+	c.names[name] = route
 }
 
-func (c *Core) pushMethod(method, pathRaw string, handlers ...Hand) *Core {
+// URL generate the path of a named route.
+// params are the route parameters in order, or a Map by parameter name.
+//
+// e.g: app.URL("handler.Handler.GetWelcomeParam", "cola") // /welcome/cola
+func (c *Core) URL(name string, params ...interface{}) (string, error) {
+	route, ok := c.names[name]
+	if !ok {
+		return "", fmt.Errorf("url: route %s not found", name)
+	}
+	return route.URL(params...)
+}
+
+// toHands convert the handlers of the route to Hand, panics on a unsupported type
+func toHands(path string, handlers []interface{}) []Hand {
+	hands := make([]Hand, 0, len(handlers))
+	for _, h := range handlers {
+		fn, ok := toHand(h)
+		if !ok {
+			panic(fmt.Sprintf("handler type %T not support in route: %s\n", h, path))
+		}
+		hands = append(hands, fn)
+	}
+	return hands
+}
+
+// appendHands returns a new slice with handlers appended to chain
+func appendHands(chain []Hand, handlers ...Hand) []Hand {
+	hands := make([]Hand, 0, len(chain)+len(handlers))
+	hands = append(hands, chain...)
+	return append(hands, handlers...)
+}
+
+// toHand convert the supported handler signatures to Hand
+func toHand(fn interface{}) (Hand, bool) {
+	switch h := fn.(type) {
+	case Hand:
+		return h, true
+	case func(*Ctx):
+		return h, true
+	case HandErr:
+		return h.Hand(), true
+	case func(*Ctx) error:
+		return HandErr(h).Hand(), true
+	}
+	return typedHand(fn)
+}
+
+func (c *Core) pushMethod(method, pathRaw string, handlers ...Hand) *Route {
 	method = ToUpper(method)
 	if method != methodUse && methodInt(method) == -1 {
 		panic(fmt.Sprintf("pushMethod: invalid http method %s\n", method))
@@ -244,7 +550,7 @@ func (c *Core) pushMethod(method, pathRaw string, handlers ...Hand) *Core {
 	pathPretty := pathRaw
 
 	if !c.CaseSensitive && len(pathPretty) > 1 {
-		pathPretty = ToLower(pathPretty)
+		pathPretty = toLowerRoute(pathPretty)
 	}
 
 	if len(pathPretty) > 1 {
@@ -276,21 +582,22 @@ func (c *Core) pushMethod(method, pathRaw string, handlers ...Hand) *Core {
 
 	if isUse {
 		for _, m := range Methods {
-			c.addRoute(m, &route)
+			c.lastRoute = c.addRoute(m, &route)
 		}
-		return c
+		return c.lastRoute
 	}
-	c.addRoute(method, &route)
-	return nil
+	c.lastRoute = c.addRoute(method, &route)
+	return c.lastRoute
 }
 
 // Static register a new route with path prefix to serve static files from the provided root directory.
 func (c *Core) Static(prefix, root string, config ...Static) *Core {
-	c.pushStatic(prefix, root, config...)
+	c.pushStatic(prefix, root, nil, config...)
 	return c
 }
 
-func (c *Core) pushStatic(prefix, root string, config ...Static) *Core {
+// pushStatic register the file server route, mw runs before serving the files
+func (c *Core) pushStatic(prefix, root string, mw []Hand, config ...Static) *Core {
 	// For security we want to restrict to the current work directory.
 	if len(root) == 0 {
 		root = "."
@@ -394,7 +701,7 @@ func (c *Core) pushStatic(prefix, root string, config ...Static) *Core {
 		// Public data
 		Method:   MethodGet,
 		Path:     prefix,
-		Handlers: []Hand{handler},
+		Handlers: appendHands(mw, handler),
 	}
 	// Add route to stack
 	c.addRoute(MethodGet, &route)
@@ -403,110 +710,67 @@ func (c *Core) pushStatic(prefix, root string, config ...Static) *Core {
 	return c
 }
 
-func (c *Core) addRoute(method string, route *Route) {
+// addRoute add the route to the stack of method,
+// returns the route which holds the handlers
+func (c *Core) addRoute(method string, route *Route) *Route {
 	// Get unique HTTP method indentifier
 	m := methodInt(method)
 
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	// prevent identically route registration
 	l := len(c.stack[m])
 	if l > 0 && c.stack[m][l-1].Path == route.Path && route.use == c.stack[m][l-1].use {
 		preRoute := c.stack[m][l-1]
 		preRoute.Handlers = append(preRoute.Handlers, route.Handlers...)
-	} else {
-		// Increment global route position
-		c.mutex.Lock()
-		c.routesCount++
-		c.mutex.Unlock()
-		route.pos = c.routesCount
-		route.Method = method
-		// Add route to the stack
-		c.stack[m] = append(c.stack[m], route)
+		return preRoute
 	}
-	// Build router tree
-	c.buildTree()
+	// Increment global route position
+	c.routesCount++
+	route.pos = c.routesCount
+	route.Method = method
+	// Add route to the stack
+	c.stack[m] = append(c.stack[m], route)
+	atomic.StoreUint32(&c.treeStale, 1)
+	return route
 }
 
+// ensureTree build the radix tree when routes were added since the last build,
+// so the embedded fasthttp.Server serves the routes without Serve
+func (c *Core) ensureTree() {
+	if atomic.LoadUint32(&c.treeStale) == 0 {
+		return
+	}
+	c.mutex.Lock()
+	if c.trees() == nil || c.treeCount != c.routesCount {
+		c.buildTree()
+	}
+	atomic.StoreUint32(&c.treeStale, 0)
+	c.mutex.Unlock()
+}
+
+// buildTree build the radix tree from the route stack,
+// the caller holds c.mutex. The tree is published as a whole,
+// requests being served keep the tree they started with.
 func (c *Core) buildTree() *Core {
-	// loop all the methods and stacks and create the prefix tree
+	trees := make([]*node, len(Methods))
 	for m := range Methods {
-		c.treeStack[m] = make(map[string][]*Route)
+		root := &node{}
+		// the stack is sorted by position, so are the routes of every node
 		for _, route := range c.stack[m] {
-			treePath := ""
-			if len(route.routeParser.segs) > 0 && len(route.routeParser.segs[0].Const) >= 3 {
-				treePath = route.routeParser.segs[0].Const[:3]
-			}
-			// create tree stack
-			c.treeStack[m][treePath] = append(c.treeStack[m][treePath], route)
+			root.insert(route.treeKey(), route)
 		}
+		trees[m] = root
 	}
-	// loop the methods and tree stacks and add global stack and sort everything
-	for m := range Methods {
-		for treePart := range c.treeStack[m] {
-			if treePart != "" {
-				// merge global tree routes in current tree stack
-				c.treeStack[m][treePart] = uniqueRouteStack(append(c.treeStack[m][treePart], c.treeStack[m][""]...))
-			}
-			// sort tree slices with the positions
-			sort.Slice(c.treeStack[m][treePart], func(i, j int) bool {
-				return c.treeStack[m][treePart][i].pos < c.treeStack[m][treePart][j].pos
-			})
-		}
-	}
-
+	c.treeStack.Store(trees)
+	c.treeCount = c.routesCount
 	return c
 }
-func (c *Core) prefork(addr string, tlsConfig *tls.Config) (err error) {
-	if isChild() {
-		runtime.GOMAXPROCS(1)
-		var ln net.Listener
-		if ln, err = reuseport.Listen("tcp4", addr); err != nil {
-			return err
-		}
-
-		if tlsConfig != nil {
-			ln = tls.NewListener(ln, tlsConfig)
-		}
-
-		Go(watchMaster)
-
-		return c.Server.Serve(ln)
-	}
-
-	type child struct {
-		pid int
-		err error
-	}
-
-	var max = runtime.GOMAXPROCS(0)
-	var childs = make(map[int]*exec.Cmd)
-	var channel = make(chan child, max)
-
-	defer func() { // defer kill all childs process
-		for _, proc := range childs {
-			_ = proc.Process.Kill()
-		}
-	}()
-
-	for i := 0; i < max; i++ {
-		cmd := exec.Command(os.Args[0], os.Args[1:]...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", envChildKey, envChildVal))
-
-		if err = cmd.Start(); err != nil {
-			return fmt.Errorf("failed to start a child prefork process, error: %v", err)
-		}
 
-		pid := cmd.Process.Pid
-		childs[pid] = cmd
-
-		go func() {
-			channel <- child{pid, cmd.Wait()}
-		}()
-	}
-
-	return (<-channel).err
+// trees returns the radix tree of every method, nil before the first build
+func (c *Core) trees() []*node {
+	trees, _ := c.treeStack.Load().([]*node)
+	return trees
 }
 
 func (c *Core) init() {
@@ -534,18 +798,42 @@ func (c *Core) init() {
 		c.CompressedFileSuffix = ".gz"
 	}
 
+	if c.Options.ShutdownTimeout <= 0 {
+		c.Options.ShutdownTimeout = 10 * time.Second
+	}
+
+	if c.Options.ExitTimeout <= 0 {
+		c.Options.ExitTimeout = 5 * time.Second
+	}
+
+	if c.Options.ErrorHandler == nil {
+		c.Options.ErrorHandler = DefaultErrorHandler
+	}
+
 	logLevel := log.LevelWarn
 	if c.Options.Debug {
 		logLevel = log.LevelDebug
 	}
-	logOutput := os.Stdout
+	var logOutput io.Writer = os.Stdout
+	var logErr error
 	if c.Options.LogPath != "" {
 		fileName := filepath.Base(os.Args[0])
-		logOutput, _ = os.OpenFile(filepath.Join(c.Options.LogPath, fileName+".log"), os.O_CREATE|os.O_APPEND|os.O_RDWR, 0755)
+		// Prefork children write their own file, no locking is needed
+		if id := os.Getenv(envChildIDKey); isChild() && id != "" {
+			fileName += "." + id
+		}
+		c.logWriter, logErr = log.NewRotateWriter(filepath.Join(c.Options.LogPath, fileName+".log"), c.Options.LogRotate)
+		if logErr == nil {
+			logOutput = c.logWriter
+		}
 	}
 
-	Log = log.NewLogger(logOutput, logLevel)
+	Log = log.NewLogger(logOutput, logLevel, c.Options.LogFormat)
+	if logErr != nil {
+		Log.Error("LogPath: %v, log to stdout\n", logErr)
+	}
 	if c.Options.Views != nil {
+		c.Views.AddFunc("url", c.URL)
 		if err := c.Views.Load(); err != nil {
 			p, _ := filepath.Abs(c.Options.viewRoot)
 			Log.D("Views: %v\n", p)
@@ -573,12 +861,13 @@ func (c *Core) init() {
 	}
 }
 
-func (c *Core) next(ctx *Ctx) (match bool, err error) {
-	// Get stack length
-	tree, ok := c.treeStack[ctx.methodINT][ctx.treePath]
-	if !ok {
-		tree = c.treeStack[ctx.methodINT][""]
+func (c *Core) next(ctx *Ctx) (match bool) {
+	// Find the routes of the path once per request
+	if !ctx.treeDone {
+		ctx.tree = c.trees()[ctx.methodINT].find(ctx.detectionPath, ctx.tree[:0])
+		ctx.treeDone = true
 	}
+	tree := ctx.tree
 	lenr := len(tree) - 1
 
 	// Loop over the route stack starting from previous index
@@ -607,23 +896,51 @@ func (c *Core) next(ctx *Ctx) (match bool, err error) {
 		// Execute first handler of route
 		ctx.indexHandler = 0
 		route.Handlers[0](ctx)
-		return match, nil // Stop scanning the stack
+		return match // Stop scanning the stack
 	}
 
 	// If ctx.Next() does not match, return 404
-	_ = ctx.SendStatus(StatusNotFound)
-	_ = ctx.SendString("Cannot " + ctx.method + " " + ctx.pathOriginal)
-
-	if !ctx.matched && methodExist(ctx) {
-		err = ErrMethodNotAllowed
+	var err error = NewError(StatusNotFound, "Cannot "+ctx.method+" "+ctx.pathOriginal)
+	if !ctx.matched {
+		if methods := allowMethods(ctx); len(methods) > 0 {
+			switch {
+			case ctx.method == MethodOptions && !c.DisableAutoOptions:
+				// Answer OPTIONS from the route table
+				ctx.Set(HeaderAllow, strings.Join(append(methods, MethodOptions), ", "))
+				ctx.Status(StatusNoContent)
+				return
+			case !c.DisableMethodNotAllowed:
+				ctx.Set(HeaderAllow, strings.Join(methods, ", "))
+				err = ErrMethodNotAllowed
+			}
+		}
 	}
+	c.handleError(ctx, err)
 	return
 }
 
+// handleError pass err to the ErrorHandler,
+// only the first error of a request is handled
+func (c *Core) handleError(ctx *Ctx, err error) {
+	if ctx.errHandled {
+		return
+	}
+	ctx.errHandled = true
+	if e := c.Options.ErrorHandler(ctx, err); e != nil {
+		ctx.Status(StatusInternalServerError).SendString(StatusMessage(StatusInternalServerError))
+	}
+}
+
 // handleRequest All request processing center
 func (c *Core) handleRequest(fctx *fasthttp.RequestCtx) {
+	c.ensureTree()
 	ctx := c.assignCtx(fctx)
 	defer c.releaseCtx(ctx)
+	defer func() {
+		if r := recover(); r != nil {
+			c.recoverPanic(ctx, r)
+		}
+	}()
 	if ctx.methodINT == -1 {
 		ctx.Status(StatusBadRequest).SendString("Invalid http method")
 		return
@@ -632,12 +949,13 @@ func (c *Core) handleRequest(fctx *fasthttp.RequestCtx) {
 	start := time.Now()
 	// Delegate next to handle the request
 	// Find match in stack
-	match, err := c.next(ctx)
-	if err != nil {
-		_ = ctx.SendStatus(StatusInternalServerError)
+	match := c.next(ctx)
+	// Save the session loaded by the handlers
+	if ctx.session != nil {
+		ctx.saveSession()
 	}
 	// Generate ETag if enabled
-	if match && c.ETag {
+	if match && c.ETag && !ctx.errHandled {
 		setETag(ctx, false)
 	}
 	if c.Debug {
@@ -647,6 +965,27 @@ func (c *Core) handleRequest(fctx *fasthttp.RequestCtx) {
 	}
 }
 
+// recoverPanic log the panic with the stack, call OnPanic hook
+// and send a 500 error to the ErrorHandler
+func (c *Core) recoverPanic(ctx *Ctx, r interface{}) {
+	stack := debug.Stack()
+	Log.Error("Panic: %v %s %s request id: %s\n%s", r, ctx.method, ctx.pathOriginal, ctx.RequestID(), stack)
+	if c.OnPanic != nil {
+		c.OnPanic(ctx, r, stack)
+	}
+	msg := StatusMessage(StatusInternalServerError)
+	if c.Debug {
+		msg = fmt.Sprintf("%v", r)
+	}
+	ctx.Response.ResetBody()
+	if ctx.errHandled {
+		// the ErrorHandler already ran, it may be the one which panicked
+		ctx.Status(StatusInternalServerError).SendString(msg)
+		return
+	}
+	c.handleError(ctx, NewError(StatusInternalServerError, msg))
+}
+
 // like https://github.com/qiangxue/fasthttp-routing/blob/master/router.go
 func (c *Core) assignCtx(fctx *fasthttp.RequestCtx) *Ctx {
 	ctx := c.pool.Get().(*Ctx)
@@ -667,7 +1006,9 @@ func New(opts ...interface{}) *Core {
 	c := &Core{
 		// Create router stack
 		stack:     make([][]*Route, methodsLen),
-		treeStack: make([]map[string][]*Route, methodsLen),
+		names:     make(map[string]*Route),
+		treeStale: 1,
+		stopped:   make(chan struct{}),
 		pool: sync.Pool{
 			New: func() interface{} {
 				return new(Ctx)
@@ -710,27 +1051,6 @@ func New(opts ...interface{}) *Core {
 	return c
 }
 
-func isChild() bool {
-	return os.Getenv(envChildKey) == envChildVal
-}
-
-func watchMaster() {
-	if runtime.GOOS == "windows" {
-		p, err := os.FindProcess(os.Getppid())
-		if err == nil {
-			_, _ = p.Wait()
-		}
-		os.Exit(1)
-	}
-	// if it is equal to 1 (init process ID),
-	// it indicates that the master process has exited
-	for range time.NewTicker(time.Millisecond * 500).C {
-		if os.Getppid() == 1 {
-			os.Exit(1)
-		}
-	}
-}
-
 // Go starts a recoverable goroutine.
 func Go(goroutine func()) {
 	GoWithRecover(goroutine, defaultRecoverGoroutine)
@@ -753,11 +1073,6 @@ func defaultRecoverGoroutine(err interface{}) {
 	Log.Error("Stack: %s", debug.Stack())
 }
 
-const (
-	envChildKey = "COLA_CHILD"
-	envChildVal = "1"
-)
-
 var (
 	// Log default global log interface
 	Log log.Interface
@@ -0,0 +1,228 @@
+package cola
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xs23933/cola/log"
+)
+
+// fieldsError is not comparable, the error path must not compare it
+type fieldsError struct {
+	fields []string
+}
+
+func (e fieldsError) Error() string { return strings.Join(e.fields, ",") }
+
+func TestDefaultErrorHandler(t *testing.T) {
+	app := New()
+	app.Add(MethodGet, "/teapot", func(c *Ctx) error { return NewError(StatusTeapot, "short and stout") })
+	app.Add(MethodGet, "/plain", func(c *Ctx) error { return errors.New("boom") })
+	tc := NewTestClient(app)
+
+	for _, tt := range []struct {
+		path, accept string
+		status       int
+		body         string
+	}{
+		{"/teapot", "", StatusTeapot, `{"msg":"short and stout","result":null,"status":false}`},
+		{"/teapot", MIMETextPlain, StatusTeapot, "short and stout"},
+		{"/teapot", MIMETextHTML, StatusTeapot, "<h1>418 I'm a teapot</h1><p>short and stout</p>"},
+		{"/plain", "", StatusInternalServerError, `{"msg":"boom","result":null,"status":false}`},
+		{"/missing", MIMETextPlain, StatusNotFound, "Cannot GET /missing"},
+	} {
+		body, err := tc.Get(tt.path).Header(HeaderAccept, tt.accept).Expect(tt.status).String()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !strings.Contains(body, tt.body) {
+			t.Errorf("GET %s Accept %q = %q, want %q", tt.path, tt.accept, body, tt.body)
+		}
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	var handled []string
+	app := New(&Options{ErrorHandler: func(c *Ctx, err error) error {
+		handled = append(handled, err.Error())
+		if err.Error() == "fail" {
+			return err
+		}
+		c.Status(StatusTeapot)
+		return c.SendString("handled: " + err.Error())
+	}})
+	app.Use(func(c *Ctx) error {
+		c.Next()
+		if c.Path() == "/twice" {
+			return fieldsError{[]string{"outer"}}
+		}
+		return nil
+	})
+	app.Add(MethodGet, "/err", func(c *Ctx) error { return errors.New("err") })
+	app.Add(MethodGet, "/twice", func(c *Ctx) error { return fieldsError{[]string{"inner"}} })
+	app.Add(MethodGet, "/fail", func(c *Ctx) error { return errors.New("fail") })
+	app.Add(MethodGet, "/ok", func(c *Ctx) error { return c.SendString("ok") })
+	tc := NewTestClient(app)
+
+	for _, tt := range []struct {
+		path    string
+		status  int
+		body    string
+		handled []string
+	}{
+		{"/ok", StatusOK, "ok", nil},
+		{"/err", StatusTeapot, "handled: err", []string{"err"}},
+		// only the first error of a request is handled
+		{"/twice", StatusTeapot, "handled: inner", []string{"inner"}},
+		// an error of the ErrorHandler sends a plain 500
+		{"/fail", StatusInternalServerError, "Internal Server Error", []string{"fail"}},
+		{"/missing", StatusTeapot, "handled: Cannot GET /missing", []string{"Cannot GET /missing"}},
+	} {
+		handled = nil
+		body, err := tc.Get(tt.path).Expect(tt.status).String()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if body != tt.body {
+			t.Errorf("GET %s = %q, want %q", tt.path, body, tt.body)
+		}
+		if strings.Join(handled, "|") != strings.Join(tt.handled, "|") {
+			t.Errorf("GET %s handled %q, want %q", tt.path, handled, tt.handled)
+		}
+	}
+}
+
+func TestRecoverPanic(t *testing.T) {
+	var (
+		recovered interface{}
+		stack     []byte
+	)
+	app := New(&Options{OnPanic: func(c *Ctx, r interface{}, s []byte) {
+		recovered, stack = r, s
+	}})
+	app.Add(MethodGet, "/panic", func(c *Ctx) {
+		c.SendString("partial")
+		panic("boom")
+	})
+	tc := NewTestClient(app)
+	buf := new(bytes.Buffer)
+	defer func(prev log.Interface) { Log = prev }(Log)
+	Log = log.NewLogger(buf, log.LevelError)
+
+	body, err := tc.Get("/panic").Header(HeaderAccept, MIMETextPlain).Expect(StatusInternalServerError).String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "Internal Server Error" {
+		t.Fatalf("body = %q, want Internal Server Error", body)
+	}
+	if recovered != "boom" || !bytes.Contains(stack, []byte("core_test.go")) {
+		t.Fatalf("OnPanic(%v, %.40q)", recovered, stack)
+	}
+	if !strings.Contains(buf.String(), "Panic: boom GET /panic") {
+		t.Fatalf("log = %q", buf.String())
+	}
+
+	// Debug sends the panic value
+	app.Debug = true
+	if body, _ = tc.Get("/panic").Header(HeaderAccept, MIMETextPlain).String(); body != "boom" {
+		t.Fatalf("Debug body = %q, want boom", body)
+	}
+}
+
+func TestRecoverErrorHandlerPanic(t *testing.T) {
+	app := New(&Options{ErrorHandler: func(c *Ctx, err error) error {
+		panic("handler " + err.Error())
+	}})
+	defer func(prev log.Interface) { Log = prev }(Log)
+	Log = log.NewLogger(new(bytes.Buffer), log.LevelError)
+	app.Add(MethodGet, "/err", func(c *Ctx) error { return errors.New("err") })
+	if err := NewTestClient(app).Get("/err").Expect(StatusInternalServerError).Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{})
+	app := New()
+	app.Add(MethodGet, "/slow", func(c *Ctx) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		c.SendString("done")
+	})
+	var hooks []string
+	app.OnShutdown(func() error { hooks = append(hooks, "first"); return nil })
+	app.OnShutdown(func() error { hooks = append(hooks, "second"); return errors.New("logged") })
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- app.Server.Serve(ln) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	res := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			res <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		res <- result{string(body), err}
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	defer func(prev log.Interface) { Log = prev }(Log)
+	Log = log.NewLogger(new(bytes.Buffer), log.LevelError)
+	if err = app.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	// the request in flight is finished
+	if r := <-res; r.err != nil || r.body != "done" {
+		t.Fatalf("GET /slow = %q, %v", r.body, r.err)
+	}
+	if err = <-served; err != nil {
+		t.Fatalf("Serve() = %v", err)
+	}
+	if got := strings.Join(hooks, ","); got != "second,first" {
+		t.Fatalf("hooks = %s, want second,first", got)
+	}
+
+	// the hooks run once
+	if err = app.Shutdown(ctx); err != nil || len(hooks) != 2 {
+		t.Fatalf("second Shutdown() = %v, hooks %v", err, hooks)
+	}
+}
+
+func TestOnStartup(t *testing.T) {
+	var hooks []string
+	app := New()
+	app.OnStartup(func() error { hooks = append(hooks, "a"); return nil })
+	app.OnStartup(func() error { hooks = append(hooks, "b"); return errors.New("stop") })
+	app.OnStartup(func() error { hooks = append(hooks, "c"); return nil })
+
+	// a hook error stops Serve before listening
+	if err := app.Serve("127.0.0.1:0"); err == nil || err.Error() != "stop" {
+		t.Fatalf("Serve() = %v, want stop", err)
+	}
+	if got := strings.Join(hooks, ","); got != "a,b" {
+		t.Fatalf("hooks = %s, want a,b", got)
+	}
+}
@@ -0,0 +1,175 @@
+package cola
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CORSConfig config of the CORS middleware
+type CORSConfig struct {
+	// Origins allowed to make cross origin requests,
+	// "*" allows all, "https://*.example.com" allows the subdomains.
+	// Optional. Default value []string{"*"}.
+	AllowOrigins []string `json:"allow_origins"`
+
+	// AllowOriginFunc is called for origins not in AllowOrigins.
+	// Optional. Default value nil.
+	AllowOriginFunc func(origin string) bool `json:"-"`
+
+	// Methods answered to a preflight request.
+	// Optional. Default value the methods registered for the path.
+	AllowMethods []string `json:"allow_methods"`
+
+	// Request headers answered to a preflight request.
+	// Optional. Default value the Access-Control-Request-Headers of the request.
+	AllowHeaders []string `json:"allow_headers"`
+
+	// Allow cookies and authorization headers,
+	// the origin is then sent back instead of "*".
+	// Optional. Default value false.
+	AllowCredentials bool `json:"allow_credentials"`
+
+	// Response headers readable by the client.
+	// Optional. Default value nil.
+	ExposeHeaders []string `json:"expose_headers"`
+
+	// Seconds the result of a preflight request can be cached.
+	// Optional. Default value 0, the header is not sent.
+	MaxAge int `json:"max_age"`
+
+	// Next skips the middleware when it returns true.
+	// Optional. Default value nil.
+	Next func(*Ctx) bool `json:"-"`
+}
+
+// CORS returns the CORS middleware, preflight requests are answered
+// with 204 and the methods registered for the path in the route table.
+//
+//	app.Use(cola.CORS(cola.CORSConfig{
+//		AllowOrigins:     []string{"https://example.com", "https://*.example.com"},
+//		AllowCredentials: true,
+//		MaxAge:           3600,
+//	}))
+func CORS(config ...CORSConfig) Hand {
+	cfg := CORSConfig{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if len(cfg.AllowOrigins) == 0 && cfg.AllowOriginFunc == nil {
+		cfg.AllowOrigins = []string{"*"}
+	}
+
+	allowAll := false
+	origins := make([]string, 0, len(cfg.AllowOrigins))
+	for _, o := range cfg.AllowOrigins {
+		o = strings.TrimSuffix(ToLower(strings.TrimSpace(o)), "/")
+		if o == "*" {
+			allowAll = true
+			continue
+		}
+		origins = append(origins, o)
+	}
+	// The response only depends on the origin when it is echoed back
+	wildcard := allowAll && !cfg.AllowCredentials
+	allowMethods := strings.Join(cfg.AllowMethods, ", ")
+	allowHeaders := strings.Join(cfg.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(cfg.ExposeHeaders, ", ")
+	maxAge := strconv.Itoa(cfg.MaxAge)
+
+	return func(c *Ctx) {
+		if cfg.Next != nil && cfg.Next(c) {
+			c.Next()
+			return
+		}
+		if !wildcard {
+			c.Append(HeaderVary, HeaderOrigin)
+		}
+
+		origin := c.Get(HeaderOrigin)
+		preflight := c.method == MethodOptions && c.Get(HeaderAccessControlRequestMethod) != ""
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		allowed := allowAll || matchOrigin(ToLower(origin), origins) ||
+			cfg.AllowOriginFunc != nil && cfg.AllowOriginFunc(origin)
+
+		if !preflight {
+			if allowed {
+				cfg.setOrigin(c, origin, wildcard)
+				if exposeHeaders != "" {
+					c.Set(HeaderAccessControlExposeHeaders, exposeHeaders)
+				}
+			}
+			c.Next()
+			return
+		}
+
+		// Preflight of a path without routes is a 404
+		methods := allowMethods
+		if methods == "" {
+			registered := allowMethodsOf(c)
+			if len(registered) == 0 {
+				c.Next()
+				return
+			}
+			methods = strings.Join(registered, ", ")
+		}
+		if allowed {
+			cfg.setOrigin(c, origin, wildcard)
+			c.Set(HeaderAccessControlAllowMethods, methods)
+			if allowHeaders != "" {
+				c.Set(HeaderAccessControlAllowHeaders, allowHeaders)
+			} else if h := c.Get(HeaderAccessControlRequestHeaders); h != "" {
+				c.Append(HeaderVary, HeaderAccessControlRequestHeaders)
+				c.Set(HeaderAccessControlAllowHeaders, h)
+			}
+			if cfg.MaxAge > 0 {
+				c.Set(HeaderAccessControlMaxAge, maxAge)
+			}
+		}
+		c.Status(StatusNoContent)
+	}
+}
+
+func (cfg *CORSConfig) setOrigin(c *Ctx, origin string, wildcard bool) {
+	if wildcard {
+		c.Set(HeaderAccessControlAllowOrigin, "*")
+		return
+	}
+	c.Set(HeaderAccessControlAllowOrigin, origin)
+	if cfg.AllowCredentials {
+		c.Set(HeaderAccessControlAllowCredentials, "true")
+	}
+}
+
+// allowMethodsOf returns the methods registered for the path of an OPTIONS request
+func allowMethodsOf(c *Ctx) []string {
+	methods := allowMethods(c)
+	if len(methods) > 0 {
+		methods = append(methods, MethodOptions)
+	}
+	return methods
+}
+
+// matchOrigin reports whether origin is in origins,
+// an origin like "https://*.example.com" matches the subdomains
+func matchOrigin(origin string, origins []string) bool {
+	for _, o := range origins {
+		if o == origin {
+			return true
+		}
+		i := strings.IndexByte(o, '*')
+		if i < 0 {
+			continue
+		}
+		prefix, suffix := o[:i], o[i+1:]
+		if len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) &&
+			!strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], "/:") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package cola
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	app := New()
+	app.Use(CORS(CORSConfig{
+		AllowOrigins:     []string{"https://a.com", "https://*.b.com"},
+		AllowCredentials: true,
+		MaxAge:           60,
+		ExposeHeaders:    []string{"X-Total"},
+	}))
+	app.Add(MethodGet, "/u/:id", func(c *Ctx) { c.SendString("u") })
+	app.Add(MethodPut, "/u/:id", func(c *Ctx) { c.SendString("u") })
+	tc := NewTestClient(app)
+
+	preflight := func(origin string) *http.Response {
+		resp, err := tc.Request(MethodOptions, "/u/1").Header(HeaderOrigin, origin).
+			Header(HeaderAccessControlRequestMethod, MethodPut).
+			Header(HeaderAccessControlRequestHeaders, "content-type").Expect(StatusNoContent).Response()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	for _, origin := range []string{"https://a.com", "https://x.b.com"} {
+		resp := preflight(origin)
+		for k, v := range map[string]string{
+			HeaderAccessControlAllowOrigin:      origin,
+			HeaderAccessControlAllowCredentials: "true",
+			HeaderAccessControlAllowMethods:     "GET, PUT, OPTIONS",
+			HeaderAccessControlAllowHeaders:     "content-type",
+			HeaderAccessControlMaxAge:           "60",
+			HeaderVary:                          "Origin, Access-Control-Request-Headers",
+		} {
+			if got := resp.Header.Get(k); got != v {
+				t.Errorf("%s: %s = %q, want %q", origin, k, got, v)
+			}
+		}
+	}
+	for _, origin := range []string{"https://b.com", "https://evil.com"} {
+		if got := preflight(origin).Header.Get(HeaderAccessControlAllowOrigin); got != "" {
+			t.Errorf("%s: %s = %q, want none", origin, HeaderAccessControlAllowOrigin, got)
+		}
+	}
+
+	err := tc.Get("/u/1").Header(HeaderOrigin, "https://a.com").Expect(StatusOK).
+		ExpectHeader(HeaderAccessControlAllowOrigin, "https://a.com").
+		ExpectHeader(HeaderAccessControlExposeHeaders, "X-Total").
+		ExpectHeader(HeaderVary, "Origin").Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tc.Request(MethodOptions, "/nope").Header(HeaderOrigin, "https://a.com").
+		Header(HeaderAccessControlRequestMethod, MethodPut).Expect(StatusNotFound).Err(); err != nil {
+		t.Fatal(err)
+	}
+	// a plain OPTIONS request is not a preflight
+	if err = tc.Request(MethodOptions, "/u/1").Expect(StatusNoContent).
+		ExpectHeader(HeaderAllow, "GET, PUT, OPTIONS").Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCORSDefault(t *testing.T) {
+	app := New()
+	app.Use(CORS())
+	app.Add(MethodGet, "/", func(c *Ctx) { c.SendString("ok") })
+	err := NewTestClient(app).Get("/").Header(HeaderOrigin, "https://z.com").
+		ExpectHeader(HeaderAccessControlAllowOrigin, "*").Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,198 @@
+package cola
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+)
+
+// CSRFConfig config of the CSRF middleware
+type CSRFConfig struct {
+	// Keep the token in the session instead of a cookie,
+	// by default the double submit cookie pattern is used.
+	// Optional. Default value false.
+	Session bool `json:"session"`
+
+	// Name of the token cookie, or the session key when Session is true.
+	// Optional. Default value "_csrf".
+	CookieName string `json:"cookie_name"`
+
+	// Cookie attributes of the token cookie.
+	// Optional. Default value Path "/", SameSite "Lax".
+	CookiePath     string `json:"cookie_path"`
+	CookieDomain   string `json:"cookie_domain"`
+	CookieSecure   bool   `json:"cookie_secure"`
+	CookieSameSite string `json:"cookie_same_site"`
+
+	// Lifetime of the token cookie.
+	// Optional. Default value 24 * time.Hour.
+	Expiration time.Duration `json:"expiration"`
+
+	// Request header holding the token, checked before FormField.
+	// Optional. Default value "X-CSRF-Token".
+	Header string `json:"header"`
+
+	// Form field holding the token, urlencoded and multipart forms.
+	// Optional. Default value "_csrf".
+	FormField string `json:"form_field"`
+
+	// Vars key of the token, Render exposes it to the templates.
+	// Optional. Default value "csrf".
+	ContextKey string `json:"context_key"`
+
+	// Paths not checked, a path ending with "/*" exempts all paths below it,
+	// e.g. "/api/*" exempts a group, "/webhook" a single route.
+	// Optional. Default value nil.
+	Exempt []string `json:"exempt"`
+
+	// Next skips the middleware when it returns true.
+	// Optional. Default value nil.
+	Next func(*Ctx) bool `json:"-"`
+}
+
+// CSRFToken is set in Vars by the CSRF middleware,
+// it prints as the token and is rendered by the csrfField template helper.
+//
+//	<meta name="csrf-token" content="{{ .csrf }}">
+//	<form method="post">{{ csrfField .csrf }}</form>
+type CSRFToken struct {
+	Field string
+	Token string
+}
+
+func (t CSRFToken) String() string {
+	return t.Token
+}
+
+// CSRF returns the CSRF middleware.
+// GET, HEAD, OPTIONS and TRACE requests get a token,
+// other methods must send it back in the header or form field
+// or are refused with ErrForbidden.
+//
+//	app.Use(cola.CSRF())
+//	app.Use(cola.CSRF(cola.CSRFConfig{Session: true, Exempt: []string{"/api/*"}}))
+func CSRF(config ...CSRFConfig) Hand {
+	cfg := CSRFConfig{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = "_csrf"
+	}
+	if cfg.CookiePath == "" {
+		cfg.CookiePath = "/"
+	}
+	if cfg.CookieSameSite == "" {
+		cfg.CookieSameSite = "Lax"
+	}
+	if cfg.Expiration <= 0 {
+		cfg.Expiration = 24 * time.Hour
+	}
+	if cfg.Header == "" {
+		cfg.Header = HeaderXCSRFToken
+	}
+	if cfg.FormField == "" {
+		cfg.FormField = "_csrf"
+	}
+	if cfg.ContextKey == "" {
+		cfg.ContextKey = "csrf"
+	}
+
+	return HandErr(func(c *Ctx) error {
+		if cfg.Next != nil && cfg.Next(c) {
+			c.Next()
+			return nil
+		}
+
+		token := cfg.token(c)
+		switch c.method {
+		case MethodGet, MethodHead, MethodOptions, MethodTrace:
+		default:
+			if !cfg.exempt(c.Path()) {
+				sent := c.Get(cfg.Header)
+				if sent == "" {
+					sent = c.FormValue(cfg.FormField)
+				}
+				if token == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+					return NewError(StatusForbidden, "Invalid CSRF token")
+				}
+			}
+		}
+
+		if token == "" {
+			token = newCSRFToken()
+			cfg.save(c, token)
+		}
+		c.Vars(cfg.ContextKey, CSRFToken{Field: cfg.FormField, Token: token})
+		c.Next()
+		return nil
+	}).Hand()
+}
+
+// token returns the token of the client, "" when it has none
+func (cfg *CSRFConfig) token(c *Ctx) string {
+	if cfg.Session {
+		token, _ := c.Session().Get(cfg.CookieName).(string)
+		return token
+	}
+	return string(c.Request.Header.Cookie(cfg.CookieName))
+}
+
+// save keep a new token in the session or the token cookie
+func (cfg *CSRFConfig) save(c *Ctx, token string) {
+	if cfg.Session {
+		c.Session().Set(cfg.CookieName, token)
+		return
+	}
+	// the cookie is readable by scripts which send the token in the header
+	c.Cookie(&Cookie{
+		Name:     cfg.CookieName,
+		Value:    token,
+		Path:     cfg.CookiePath,
+		Domain:   cfg.CookieDomain,
+		MaxAge:   int(cfg.Expiration.Seconds()),
+		Secure:   cfg.CookieSecure,
+		SameSite: cfg.CookieSameSite,
+	})
+}
+
+// exempt reports whether path is excluded by Exempt
+func (cfg *CSRFConfig) exempt(path string) bool {
+	for _, p := range cfg.Exempt {
+		if strings.HasSuffix(p, "/*") {
+			prefix := p[:len(p)-2]
+			if path == prefix || strings.HasPrefix(path, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// csrfField renders the hidden input of a CSRFToken, the csrfField template helper
+func csrfField(token interface{}) template.HTML {
+	field, value := "_csrf", ""
+	switch t := token.(type) {
+	case CSRFToken:
+		field, value = t.Field, t.Token
+	case nil:
+	default:
+		value = fmt.Sprint(t)
+	}
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(field) +
+		`" value="` + template.HTMLEscapeString(value) + `">`)
+}
@@ -0,0 +1,40 @@
+package cola
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	for _, session := range []bool{false, true} {
+		app := New()
+		app.Use(CSRF(CSRFConfig{Session: session, Exempt: []string{"/api/*"}}))
+		app.Add(MethodGet, "/form", func(c *Ctx) { c.SendString(fmt.Sprint(c.Vars("csrf"))) })
+		app.Add(MethodPost, "/form", func(c *Ctx) { c.SendString("posted") })
+		app.Add(MethodPost, "/api/hook", func(c *Ctx) { c.SendString("hook") })
+		tc := NewTestClient(app)
+
+		token, err := tc.Get("/form").Expect(StatusOK).String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token == "" {
+			t.Fatalf("session %v: empty token", session)
+		}
+		if again, _ := tc.Get("/form").String(); again != token {
+			t.Errorf("session %v: token changed %q, want %q", session, again, token)
+		}
+		for _, req := range []*TestRequest{
+			tc.Post("/form").Expect(StatusForbidden),
+			tc.Post("/form").Field("_csrf", "bad").Expect(StatusForbidden),
+			tc.Post("/form").Field("_csrf", token).Expect(StatusOK),
+			tc.Post("/form").Header("X-CSRF-Token", token).Expect(StatusOK),
+			NewTestClient(app).Post("/form").Field("_csrf", token).Expect(StatusForbidden),
+			tc.Post("/api/hook").Expect(StatusOK),
+		} {
+			if err := req.Err(); err != nil {
+				t.Errorf("session %v: %v", session, err)
+			}
+		}
+	}
+}
@@ -10,12 +10,16 @@ import (
 	"mime/multipart"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/schema"
 	"github.com/valyala/fasthttp"
+	"github.com/xs23933/cola/log"
+	"github.com/xs23933/cola/session"
+	"github.com/xs23933/uid"
 )
 
 // maxParams defines the maximum number of parameters per route.
@@ -35,11 +39,14 @@ type Ctx struct {
 	detectionPathBuffer []byte // HTTP detectionPath buffer
 	pathOriginal        string
 	values              [maxParams]string // Route parameter values
-	treePath            string            // Path for the search in the tree
+	tree                []*Route          // Routes found in the tree for the detection path
+	treeDone            bool              // tree is searched for the detection path
 	matched             bool              // Non use route matched
 	route               *Route
+	errHandled          bool // an error was passed to the ErrorHandler
 	baseURI             string
 	theme               string
+	session             *session.Session // loaded by Session
 }
 
 func (c *Ctx) init(ctx *fasthttp.RequestCtx) {
@@ -52,7 +59,9 @@ func (c *Ctx) init(ctx *fasthttp.RequestCtx) {
 	c.index = -1
 	c.indexHandler = 0
 	c.matched = false
+	c.errHandled = false
 	c.baseURI = ""
+	c.session = nil
 	c.depPaths()
 }
 
@@ -69,6 +78,9 @@ func (c *Ctx) Render(f string, optionalBind ...interface{}) error {
 	c.VisitUserValues(func(k []byte, v interface{}) {
 		binds[BytesToString(k)] = v
 	})
+	if c.hasSession() {
+		binds["flashes"] = &flashes{c}
+	}
 
 	if len(optionalBind) > 0 {
 		binding = optionalBind[0]
@@ -149,12 +161,8 @@ func (c *Ctx) depPaths() {
 	}
 	c.detectionPath = BytesToString(c.detectionPathBuffer)
 
-	// Define the path for dividing routes into areas for fast tree detection, so that fewer routes need to be traversed,
-	// since the first three characters area select a list of routes
-	c.treePath = c.treePath[0:0]
-	if len(c.detectionPath) >= 3 {
-		c.treePath = c.detectionPath[:3]
-	}
+	// The routes are searched in the tree again for the new detection path
+	c.treeDone = false
 }
 
 // Next method in the stack that match
@@ -232,6 +240,15 @@ func (c *Ctx) Status(status int) *Ctx {
 	return c
 }
 
+// RequestID returns the X-Request-ID request header,
+// or the fasthttp request id when the header is missing.
+func (c *Ctx) RequestID() string {
+	if id := c.Get(HeaderXRequestID); id != "" {
+		return id
+	}
+	return strconv.FormatUint(c.ID(), 10)
+}
+
 // Hostname contains the hostname derived from the Host HTTP header.
 // Returned value is only valid within the handler. Do not store any references.
 // Make copies or use the Immutable setting instead.
@@ -287,9 +304,18 @@ func (c *Ctx) JSONP(data interface{}, callback ...string) error {
 	return c.SendString(result)
 }
 
-// ToJSON send json add status
+// ToJSON send json add status,
+// a *ValidationError is sent as 422 with the field errors in "errors"
 func (c *Ctx) ToJSON(data interface{}, err error) error {
-	dat := map[string]interface{}{
+	if _, ok := err.(*ValidationError); ok {
+		c.Status(StatusUnprocessableEntity)
+	}
+	return c.JSON(result(data, err))
+}
+
+// result returns the response body sent by ToJSON
+func result(data interface{}, err error) Map {
+	dat := Map{
 		"status": true,
 		"msg":    "ok",
 		"result": data,
@@ -298,16 +324,31 @@ func (c *Ctx) ToJSON(data interface{}, err error) error {
 	if err != nil {
 		dat["status"] = false
 		dat["msg"] = err.Error()
+		if ve, ok := err.(*ValidationError); ok {
+			dat["errors"] = ve.Map()
+		}
 	}
-	return c.JSON(dat)
+	return dat
+}
+
+// decoderPool helps to improve ReadBody's and Bind's performance.
+// A decoder caches the struct fields of its alias tag, so every tag has its own pool
+var decoderPool = map[string]*sync.Pool{
+	"form":   newDecoderPool("form"),
+	"query":  newDecoderPool("query"),
+	"param":  newDecoderPool("param"),
+	"header": newDecoderPool("header"),
+	"cookie": newDecoderPool("cookie"),
 }
 
-// decoderPool helps to improve ReadBody's and QueryParser's performance
-var decoderPool = &sync.Pool{New: func() interface{} {
-	var decoder = schema.NewDecoder()
-	decoder.IgnoreUnknownKeys(true)
-	return decoder
-}}
+func newDecoderPool(tag string) *sync.Pool {
+	return &sync.Pool{New: func() interface{} {
+		var decoder = schema.NewDecoder()
+		decoder.SetAliasTag(tag)
+		decoder.IgnoreUnknownKeys(true)
+		return decoder
+	}}
+}
 
 // Vars makes it possible to pass interface{} values under string keys scoped to the request
 // and therefore available to all following routes that match the request.
@@ -355,6 +396,40 @@ func (c *Ctx) Params(key string, defaultValue ...string) string {
 	return defaultString("", defaultValue)
 }
 
+// ParamsInt returns the route parameter as int,
+// a *Error with status 400 is returned when the parameter is not a number.
+func (c *Ctx) ParamsInt(key string) (int, error) {
+	v, err := strconv.Atoi(c.Params(key))
+	if err != nil {
+		return 0, paramError(key, err)
+	}
+	return v, nil
+}
+
+// ParamsUint returns the route parameter as uint,
+// a *Error with status 400 is returned when the parameter is not a unsigned number.
+func (c *Ctx) ParamsUint(key string) (uint, error) {
+	v, err := strconv.ParseUint(c.Params(key), 10, 0)
+	if err != nil {
+		return 0, paramError(key, err)
+	}
+	return uint(v), nil
+}
+
+// ParamsUID returns the route parameter as uid.UID,
+// a *Error with status 400 is returned when the parameter is not a uid.
+func (c *Ctx) ParamsUID(key string) (uid.UID, error) {
+	v := c.Params(key)
+	if !isUID(v) {
+		return uid.Nil, paramError(key, fmt.Errorf("invalid uid %q", v))
+	}
+	return uid.FromString(v)
+}
+
+func paramError(key string, err error) *Error {
+	return NewError(StatusBadRequest, "param "+key+": "+err.Error())
+}
+
 // Path returns the path part of the request URL.
 // Optionally, you could override the path.
 func (c *Ctx) Path(override ...string) string {
@@ -585,33 +660,25 @@ func (c *Ctx) Body() []byte {
 // application/json, application/xml, application/x-www-form-urlencoded, multipart/form-data
 // If none of the content types above are matched, it will return a ErrUnprocessableEntity error
 func (c *Ctx) ReadBody(out interface{}) error {
-	// Get decoder from pool
-	schemaDecoder := decoderPool.Get().(*schema.Decoder)
-	defer decoderPool.Put(schemaDecoder)
-
 	// Get content-type
 	ctype := ToLower(BytesToString(c.Request.Header.ContentType()))
 
 	switch {
 	case strings.HasPrefix(ctype, MIMEApplicationJSON):
-		schemaDecoder.SetAliasTag("json")
 		return json.Unmarshal(c.Request.Body(), out)
 	case strings.HasPrefix(ctype, MIMEApplicationForm):
-		schemaDecoder.SetAliasTag("form")
 		data := make(map[string][]string)
 		c.PostArgs().VisitAll(func(key []byte, val []byte) {
 			data[BytesToString(key)] = append(data[BytesToString(key)], BytesToString(val))
 		})
-		return schemaDecoder.Decode(out, data)
+		return decode("form", out, data)
 	case strings.HasPrefix(ctype, MIMEMultipartForm):
-		schemaDecoder.SetAliasTag("form")
 		data, err := c.MultipartForm()
 		if err != nil {
 			return err
 		}
-		return schemaDecoder.Decode(out, data.Value)
+		return decode("form", out, data.Value)
 	case strings.HasPrefix(ctype, MIMETextXML), strings.HasPrefix(ctype, MIMEApplicationXML):
-		schemaDecoder.SetAliasTag("xml")
 		return xml.Unmarshal(c.Request.Body(), out)
 	}
 	// No suitable content type found
@@ -683,3 +750,15 @@ func (c *Ctx) Fresh() bool {
 	}
 	return true
 }
+
+// Logger returns Log with the request id, method, path and ip of the request
+//
+//	c.Logger().Info("user %d created", id)
+func (c *Ctx) Logger() log.Interface {
+	return Log.With(
+		"request_id", string([]byte(c.RequestID())),
+		"method", string([]byte(c.method)),
+		"path", string([]byte(c.path)),
+		"ip", string([]byte(c.IP())),
+	)
+}
@@ -1,6 +1,7 @@
 package cola
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -8,18 +9,24 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 )
 
 // Engine Module engine
 type Engine struct {
 	core *Core
 	quit chan os.Signal
+
+	mu       sync.RWMutex
+	signals  map[os.Signal]func(*Engine)
+	stopOnce sync.Once
 }
 
 var (
 	modules   = make(map[string]ModuleInfo)
 	modulesMu sync.RWMutex
 	modexit   = make([]hasExit, 0)
+	modreload = make([]hasReload, 0)
 )
 
 // Module interface
@@ -48,17 +55,43 @@ type hasExit interface {
 	Exit()
 }
 
+type hasReload interface {
+	Reload()
+}
+
 // NewEngine 创建
 func NewEngine(opts ...interface{}) *Engine {
 	engine := &Engine{
-		core: New(opts...),
-		quit: make(chan os.Signal, 1),
+		core:    New(opts...),
+		quit:    make(chan os.Signal, 1),
+		signals: make(map[os.Signal]func(*Engine)),
 	}
-	signal.Notify(engine.quit, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2)
+	// the prefork master and children leave the signals to the engine
+	engine.core.engineSignals = true
+	engine.Signal(os.Interrupt, (*Engine).Shutdown)
+	engine.Signal(syscall.SIGTERM, (*Engine).Shutdown)
+	engine.Signal(syscall.SIGQUIT, (*Engine).Shutdown)
+	engine.Signal(syscall.SIGHUP, (*Engine).Reload)
+	engine.Signal(syscall.SIGUSR1, (*Engine).ReopenLog)
+	engine.Signal(syscall.SIGUSR2, nil)
 	go engine.looper()
 	return engine
 }
 
+// Signal set the action run when the process receives sig, a nil action ignores the signal.
+//
+// Default: SIGINT, SIGTERM, SIGQUIT shutdown, SIGHUP reload, SIGUSR1 reopen the log file, SIGUSR2 ignored.
+// The actions also run in the prefork master and children, see Reload and ReopenLog.
+//
+//	engine.Signal(syscall.SIGUSR2, func(e *cola.Engine) { ... })
+func (e *Engine) Signal(sig os.Signal, fn func(*Engine)) *Engine {
+	e.mu.Lock()
+	e.signals[sig] = fn
+	e.mu.Unlock()
+	signal.Notify(e.quit, sig)
+	return e
+}
+
 // Core 返回 core对象
 func (e *Engine) Core() *Core {
 	return e.core
@@ -72,6 +105,9 @@ func (e *Engine) Serve(port interface{}) error {
 		if mod, ok := mo.(hasExit); ok {
 			modexit = append(modexit, mod)
 		}
+		if mod, ok := mo.(hasReload); ok {
+			modreload = append(modreload, mod)
+		}
 		if mod, ok := mo.(hasStart); ok { // 独立启动程序, 那就启动
 			mod.Start(e)
 		}
@@ -82,25 +118,71 @@ func (e *Engine) Serve(port interface{}) error {
 			e.core.Use(hook.LastHook)
 		}
 	}
-	return e.core.Serve(port)
+	if err := e.core.Serve(port); err != nil {
+		return err
+	}
+	// Serve returns as soon as the listener is closed, wait for the connections to drain
+	<-e.core.stopped
+	return nil
 }
 
-func (e *Engine) looper() {
-	for range e.quit {
+// Shutdown gracefully shuts down the server,
+// waiting at most Options.ShutdownTimeout for the open connections
+func (e *Engine) Shutdown() {
+	e.stopOnce.Do(func() {
 		Log.D("Shutdown")
-		e.core.Server.Shutdown()
+		ctx, cancel := context.WithTimeout(context.Background(), e.core.Options.ShutdownTimeout)
+		defer cancel()
+		if err := e.core.Shutdown(ctx); err != nil {
+			Log.Error("Shutdown: %v\n", err)
+		}
+	})
+}
+
+// Reload call Reload of the loaded modules,
+// the prefork master then restarts the children one by one, see Core.Restart
+func (e *Engine) Reload() {
+	Log.D("Reload")
+	for _, m := range modreload {
+		m.Reload()
 	}
-	// for {
-	// 	select {
-	// 	case <-e.quit:
+	e.core.Restart()
+}
 
-	// 	}
-	// }
+// ReopenLog reopen the log file of Options.LogPath,
+// the prefork master forwards it to the children
+func (e *Engine) ReopenLog() {
+	Log.D("ReopenLog")
+	if err := e.core.ReopenLog(); err != nil {
+		Log.Error("ReopenLog: %v\n", err)
+	}
 }
 
+func (e *Engine) looper() {
+	for sig := range e.quit {
+		e.mu.RLock()
+		fn := e.signals[sig]
+		e.mu.RUnlock()
+		if fn != nil {
+			fn(e)
+		}
+	}
+}
+
+// Exit call Exit of the loaded modules in reverse order,
+// waiting at most Options.ExitTimeout for each module
 func (e *Engine) Exit() {
-	for _, m := range modexit {
-		m.Exit()
+	for i := len(modexit) - 1; i >= 0; i-- {
+		done := make(chan struct{})
+		go func(m hasExit) {
+			defer close(done)
+			m.Exit()
+		}(modexit[i])
+		select {
+		case <-done:
+		case <-time.After(e.core.Options.ExitTimeout):
+			Log.Warn("Exit: module %T timeout\n", modexit[i])
+		}
 	}
 }
 
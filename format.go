@@ -0,0 +1,352 @@
+package cola
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Accepts returns the best of offers for the Accept header based on the q-values,
+// offers are mime types or file extensions like "json".
+// It returns the first offer when the header is missing, and "" when nothing is acceptable.
+//
+//	switch c.Accepts("json", "html") {
+//	case "json":
+//	case "html":
+//	}
+func (c *Ctx) Accepts(offers ...string) string {
+	return getOffer(c.Get(HeaderAccept), matchMIME, offers...)
+}
+
+// AcceptsEncodings returns the best of offers for the Accept-Encoding header
+func (c *Ctx) AcceptsEncodings(offers ...string) string {
+	return getOffer(c.Get(HeaderAcceptEncoding), matchEncoding, offers...)
+}
+
+// AcceptsLanguages returns the best of offers for the Accept-Language header,
+// "en" in the header accepts the offer "en-US"
+func (c *Ctx) AcceptsLanguages(offers ...string) string {
+	return getOffer(c.Get(HeaderAcceptLanguage), matchLanguage, offers...)
+}
+
+// Format send data in the format of the Accept header with the best q-value:
+// json, xml, yaml, plain text, or html rendered by Views with tplName.
+// html is only offered when tplName is given, json is sent when
+// nothing is acceptable.
+// yaml and text use the json names of the fields, text is the json of data
+// unless it is a string, an error or a fmt.Stringer.
+// It returns ErrNotAcceptable when data cannot be encoded in the format.
+//
+//	c.Format(user)           // json, xml, yaml or text
+//	c.Format(user, "user")   // html rendered with the user template too
+func (c *Ctx) Format(data interface{}, tplName ...string) error {
+	offers := formatOffers
+	if len(tplName) > 0 && c.Core.Views != nil {
+		offers = formatOffersHTML
+	}
+	c.Append(HeaderVary, HeaderAccept)
+
+	var (
+		raw []byte
+		err error
+	)
+	offer := c.Accepts(offers...)
+	switch offer {
+	case MIMETextHTML:
+		return c.Render(tplName[0], data)
+	case MIMEApplicationXML, MIMETextXML:
+		raw, err = marshalXML(data)
+	case MIMEApplicationYAML, mimeApplicationXYAML, mimeTextYAML:
+		raw, err = marshalYAML(data)
+	case MIMETextPlain:
+		raw, err = marshalText(data)
+	default:
+		offer = MIMEApplicationJSON
+		raw, err = json.Marshal(data)
+	}
+	if err != nil {
+		return NewError(StatusNotAcceptable, "cannot encode the response as "+offer+": "+err.Error())
+	}
+	c.Response.SetBodyRaw(raw)
+	if offer == MIMEApplicationJSON {
+		c.Response.Header.SetContentType(MIMEApplicationJSON)
+	} else {
+		c.Response.Header.SetContentType(offer + "; charset=utf-8")
+	}
+	return nil
+}
+
+const (
+	mimeApplicationXYAML = "application/x-yaml"
+	mimeTextYAML         = "text/yaml"
+)
+
+var (
+	// formats of Format, the first one is used for */*
+	formatOffers     = []string{MIMEApplicationJSON, MIMEApplicationXML, MIMETextXML, MIMEApplicationYAML, mimeApplicationXYAML, mimeTextYAML, MIMETextPlain}
+	formatOffersHTML = append([]string{MIMEApplicationJSON, MIMETextHTML}, formatOffers[1:]...)
+)
+
+type acceptSpec struct {
+	value string
+	q     float64
+}
+
+// parseAccept returns the values of an Accept header sorted by q-value,
+// the values without wildcard come first when the q-values are equal
+func parseAccept(header string) []acceptSpec {
+	specs := make([]acceptSpec, 0, 4)
+	for _, part := range strings.Split(header, ",") {
+		value, q := part, 1.0
+		if i := strings.IndexByte(part, ';'); i != -1 {
+			value = part[:i]
+			for _, param := range strings.Split(part[i+1:], ";") {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					var err error
+					if q, err = strconv.ParseFloat(param[2:], 64); err != nil {
+						q = 0
+					}
+				}
+			}
+		}
+		if value = ToLower(strings.TrimSpace(value)); value == "" || q <= 0 {
+			continue
+		}
+		specs = append(specs, acceptSpec{value, q})
+	}
+	sort.SliceStable(specs, func(i, j int) bool {
+		if specs[i].q != specs[j].q {
+			return specs[i].q > specs[j].q
+		}
+		return strings.Count(specs[i].value, "*") < strings.Count(specs[j].value, "*")
+	})
+	return specs
+}
+
+// getOffer returns the first offer matching the best value of the header
+func getOffer(header string, match func(spec, offer string) bool, offers ...string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if header == "" {
+		return offers[0]
+	}
+	for _, spec := range parseAccept(header) {
+		for _, offer := range offers {
+			if match(spec.value, offer) {
+				return offer
+			}
+		}
+	}
+	return ""
+}
+
+func matchMIME(spec, offer string) bool {
+	mime := ToLower(offer)
+	if !strings.Contains(mime, "/") {
+		mime = GetMIME(mime)
+	}
+	if i := strings.IndexByte(mime, ';'); i != -1 {
+		mime = strings.TrimSpace(mime[:i])
+	}
+	switch {
+	case spec == "*/*":
+		return true
+	case strings.HasSuffix(spec, "/*"):
+		return strings.HasPrefix(mime, spec[:len(spec)-1])
+	}
+	return spec == mime
+}
+
+func matchEncoding(spec, offer string) bool {
+	return spec == "*" || spec == ToLower(offer)
+}
+
+func matchLanguage(spec, offer string) bool {
+	offer = ToLower(offer)
+	return spec == "*" || spec == offer || strings.HasPrefix(offer, spec+"-")
+}
+
+// marshalText returns data as plain text, the json of data is used
+// unless data is a string, an error or a fmt.Stringer
+func marshalText(data interface{}) ([]byte, error) {
+	switch v := data.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case error:
+		return []byte(v.Error()), nil
+	case fmt.Stringer:
+		return []byte(v.String()), nil
+	}
+	return json.Marshal(data)
+}
+
+// marshalYAML encodes the json of data as yaml,
+// so the fields have their json names
+func marshalYAML(data interface{}) ([]byte, error) {
+	node, err := jsonNode(data)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(node)
+}
+
+// jsonNode returns the json of data as a yaml node keeping the order of the fields
+func jsonNode(data interface{}) (*yaml.Node, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err = yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	node := doc.Content[0]
+	plainStyle(node)
+	return node, nil
+}
+
+// plainStyle drops the flow and quoted styles of the json,
+// strings stay quoted when yaml.Marshal would quote them
+func plainStyle(node *yaml.Node) {
+	node.Style = 0
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" {
+		if raw, err := yaml.Marshal(node.Value); err == nil && (raw[0] == '"' || raw[0] == '\'') {
+			node.Style = yaml.DoubleQuotedStyle
+		}
+	}
+	for _, n := range node.Content {
+		plainStyle(n)
+	}
+}
+
+// marshalXML encodes data as xml, maps with string keys are supported
+// and encoded as the "response" element.
+// Values encoding/xml does not support, like structs with map fields,
+// are encoded from their json.
+func marshalXML(data interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(buf)
+	var err error
+	if m, ok := toXML(data).(xmlMap); ok {
+		err = enc.EncodeElement(m, xml.StartElement{Name: xml.Name{Local: "response"}})
+	} else {
+		err = enc.Encode(data)
+	}
+	if _, ok := err.(*xml.UnsupportedTypeError); ok {
+		var node *yaml.Node
+		if node, err = jsonNode(data); err != nil {
+			return nil, err
+		}
+		buf.Reset()
+		buf.WriteString(xml.Header)
+		enc = xml.NewEncoder(buf)
+		err = enc.EncodeElement(xmlNode{node}, xml.StartElement{Name: xml.Name{Local: xmlName(data)}})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// xmlName returns the element name of data, the name of its type or "response"
+func xmlName(data interface{}) string {
+	t := reflect.TypeOf(data)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t != nil && t.Name() != "" {
+		return t.Name()
+	}
+	return "response"
+}
+
+// xmlNode encodes the json of a value, objects as elements in the order
+// of their fields and arrays as repeated elements
+type xmlNode struct {
+	n *yaml.Node
+}
+
+// MarshalXML implements xml.Marshaler
+func (x xmlNode) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	switch x.n.Kind {
+	case yaml.MappingNode:
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		for i := 0; i+1 < len(x.n.Content); i += 2 {
+			el := xml.StartElement{Name: xml.Name{Local: x.n.Content[i].Value}}
+			if err := e.EncodeElement(xmlNode{x.n.Content[i+1]}, el); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	case yaml.SequenceNode:
+		for _, item := range x.n.Content {
+			if err := e.EncodeElement(xmlNode{item}, start); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if x.n.Tag == "!!null" {
+		return e.EncodeElement("", start)
+	}
+	return e.EncodeElement(x.n.Value, start)
+}
+
+// xmlMap encodes a map with string keys as elements sorted by key,
+// encoding/xml does not support maps
+type xmlMap struct {
+	v reflect.Value
+}
+
+// MarshalXML implements xml.Marshaler
+func (m xmlMap) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	keys := m.v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	for _, k := range keys {
+		el := xml.StartElement{Name: xml.Name{Local: k.String()}}
+		if err := e.EncodeElement(toXML(m.v.MapIndex(k).Interface()), el); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// toXML wraps the maps in data, slices are copied to wrap their items
+func toXML(data interface{}) interface{} {
+	v := reflect.ValueOf(data)
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			return xmlMap{v}
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return data
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = toXML(v.Index(i).Interface())
+		}
+		return items
+	}
+	return data
+}
@@ -0,0 +1,111 @@
+package cola
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	app := New()
+	app.Add(MethodGet, "/", func(c *Ctx) error {
+		return c.Format(Map{"a": 1, "list": []Map{{"x": "y"}}})
+	})
+	tc := NewTestClient(app)
+
+	for _, tt := range []struct{ accept, contentType, body string }{
+		{"", MIMEApplicationJSON, `{"a":1,"list":[{"x":"y"}]}`},
+		{"image/png", MIMEApplicationJSON, `{"a":1,"list":[{"x":"y"}]}`},
+		{"application/xml", MIMEApplicationXMLCharsetUTF8, `<response><a>1</a><list><x>y</x></list></response>`},
+		{"application/x-yaml", "application/x-yaml; charset=utf-8", "a: 1\nlist:\n    - x: \"y\"\n"},
+		{"text/plain", MIMETextPlainCharsetUTF8, `{"a":1,"list":[{"x":"y"}]}`},
+		// html is not offered without a template
+		{"text/html,application/xml;q=0.9,*/*;q=0.8", MIMEApplicationXMLCharsetUTF8, "<response>"},
+	} {
+		req := tc.Get("/").Header(HeaderAccept, tt.accept).Expect(StatusOK)
+		body, err := req.String()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		resp, _ := req.Response()
+		if ct := resp.Header.Get(HeaderContentType); ct != tt.contentType {
+			t.Errorf("Accept %q: Content-Type = %q, want %q", tt.accept, ct, tt.contentType)
+		}
+		if !strings.Contains(body, tt.body) {
+			t.Errorf("Accept %q: body = %q, want %q", tt.accept, body, tt.body)
+		}
+	}
+}
+
+type formatUser struct {
+	ID    int               `json:"id"`
+	Name  string            `json:"name"`
+	Tags  []string          `json:"tags"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+type formatName string
+
+func (n formatName) String() string { return "name: " + string(n) }
+
+func TestFormatStruct(t *testing.T) {
+	for _, tt := range []struct {
+		data         interface{}
+		accept, body string
+	}{
+		{formatUser{ID: 1, Name: "bob", Tags: []string{"a", "b"}}, "application/x-yaml", "id: 1\nname: bob\ntags:\n    - a\n    - b\n"},
+		{formatUser{ID: 1, Name: "123"}, "application/x-yaml", "id: 1\nname: \"123\"\ntags: null\n"},
+		{Map{"s": "a\nb", "t": "y", "u": "1:20"}, "application/x-yaml", "s: |-\n    a\n    b\nt: \"y\"\nu: \"1:20\"\n"},
+		{formatUser{ID: 1, Name: "bob"}, "text/plain", `{"id":1,"name":"bob","tags":null}`},
+		{formatName("bob"), "text/plain", "name: bob"},
+		{formatName("bob"), "application/xml", "<formatName>bob</formatName>"},
+		// encoding/xml does not support maps, the json is encoded
+		{&formatUser{ID: 1, Name: "b<b", Tags: []string{"a", "b"}, Attrs: map[string]string{"k": "v"}}, "application/xml",
+			"<formatUser><id>1</id><name>b&lt;b</name><tags>a</tags><tags>b</tags><attrs><k>v</k></attrs></formatUser>"},
+	} {
+		app := New()
+		app.Add(MethodGet, "/", func(c *Ctx) error {
+			return c.Format(tt.data)
+		})
+		body, err := NewTestClient(app).Get("/").Header(HeaderAccept, tt.accept).Expect(StatusOK).String()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !strings.Contains(body, tt.body) {
+			t.Errorf("Format(%#v) %s = %q, want %q", tt.data, tt.accept, body, tt.body)
+		}
+	}
+}
+
+func TestFormatNotAcceptable(t *testing.T) {
+	app := New()
+	app.Add(MethodGet, "/", func(c *Ctx) error {
+		return c.Format(Map{"ch": make(chan int)})
+	})
+	tc := NewTestClient(app)
+	for _, accept := range []string{"", "application/xml", "application/x-yaml", "text/plain"} {
+		if err := tc.Get("/").Header(HeaderAccept, accept).Expect(StatusNotAcceptable).Err(); err != nil {
+			t.Errorf("Accept %q: %v", accept, err)
+		}
+	}
+}
+
+func TestAccepts(t *testing.T) {
+	app := New()
+	app.Add(MethodGet, "/", func(c *Ctx) error {
+		return c.SendString(c.Accepts("json", "html") + "|" +
+			c.AcceptsEncodings("br", "gzip") + "|" +
+			c.AcceptsLanguages("en-US", "zh-CN"))
+	})
+	body, err := NewTestClient(app).Get("/").
+		Header(HeaderAccept, "text/*;q=0.5, application/json;q=0.4").
+		Header(HeaderAcceptEncoding, "gzip;q=1.0, br;q=0.8").
+		Header(HeaderAcceptLanguage, "zh;q=0.9, en;q=0.8").String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "html|gzip|zh-CN" {
+		t.Fatalf("Accepts = %q, want html|gzip|zh-CN", body)
+	}
+}
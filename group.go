@@ -0,0 +1,162 @@
+package cola
+
+import (
+	"path"
+	"sort"
+)
+
+// Group routes with a common prefix and middleware,
+// the middleware of a group only runs for the routes registered on the group.
+//
+// e.g:
+//
+//	api := app.Group("/api", auth)
+//	api.Get("/user/:id", getUser) // GET /api/user/:id runs auth, getUser
+//	api.Use(new(handler.User))    // reflected methods below /api
+type Group struct {
+	core     *Core
+	prefix   string
+	handlers []Hand // middleware of the group
+}
+
+// Group create a route group with prefix and middleware
+func (c *Core) Group(prefix string, mw ...Hand) *Group {
+	return &Group{
+		core:     c,
+		prefix:   joinPath("", prefix),
+		handlers: appendHands(nil, mw...),
+	}
+}
+
+// Group create a sub group, the middleware of the parent group runs first
+func (g *Group) Group(prefix string, mw ...Hand) *Group {
+	return &Group{
+		core:     g.core,
+		prefix:   joinPath(g.prefix, prefix),
+		handlers: g.chain(mw...),
+	}
+}
+
+// Prefix returns the full path prefix of the group
+func (g *Group) Prefix() string {
+	return g.prefix
+}
+
+// Use add middleware or register reflected Handler structs below the group prefix.
+//
+// Middleware is added to the group chain,
+// only the routes registered after Use will run it.
+func (g *Group) Use(args ...interface{}) *Group {
+	for _, arg := range args {
+		if a, ok := arg.(handle); ok {
+			g.core.buildHandles(a, g)
+			continue
+		}
+		if fn, ok := toHand(arg); ok {
+			g.handlers = append(g.handlers, fn)
+			continue
+		}
+		Log.Error("Group Use not support %v\n", arg)
+	}
+	return g
+}
+
+// Add register handlers for method and path below the group prefix
+func (g *Group) Add(method, path string, handlers ...interface{}) *Group {
+	g.core.pushMethod(method, joinPath(g.prefix, path), g.chain(toHands(path, handlers)...)...)
+	return g
+}
+
+// Name set the name of the last registered route, used by Core.URL
+func (g *Group) Name(name string) *Group {
+	g.core.Name(name)
+	return g
+}
+
+// Get register a GET route
+func (g *Group) Get(path string, handlers ...interface{}) *Group {
+	return g.Add(MethodGet, path, handlers...)
+}
+
+// Post register a POST route
+func (g *Group) Post(path string, handlers ...interface{}) *Group {
+	return g.Add(MethodPost, path, handlers...)
+}
+
+// Put register a PUT route
+func (g *Group) Put(path string, handlers ...interface{}) *Group {
+	return g.Add(MethodPut, path, handlers...)
+}
+
+// Delete register a DELETE route
+func (g *Group) Delete(path string, handlers ...interface{}) *Group {
+	return g.Add(MethodDelete, path, handlers...)
+}
+
+// Patch register a PATCH route
+func (g *Group) Patch(path string, handlers ...interface{}) *Group {
+	return g.Add(MethodPatch, path, handlers...)
+}
+
+// Static serve static files below the group prefix,
+// the group middleware runs before the files are served
+func (g *Group) Static(prefix, root string, config ...Static) *Group {
+	g.core.pushStatic(joinPath(g.prefix, prefix), root, g.handlers, config...)
+	return g
+}
+
+// Mount register the routes of another cola app below prefix.
+// The group middleware runs first, then the middleware of the app
+// registered before the route, static routes of the mounted app are not supported.
+func (g *Group) Mount(prefix string, app *Core) *Group {
+	prefix = joinPath(g.prefix, prefix)
+
+	// Collect the routes once, use routes are pushed on every method
+	seen := make(map[*Route]struct{})
+	routes := make([]*Route, 0)
+	for m := range app.stack {
+		for _, route := range app.stack[m] {
+			if _, ok := seen[route]; ok {
+				continue
+			}
+			seen[route] = struct{}{}
+			routes = append(routes, route)
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].pos < routes[j].pos
+	})
+
+	uses := make([]*Route, 0)
+	for _, route := range routes {
+		if route.use && len(route.routeParser.segs) == 0 {
+			Log.Warn("Mount: static route %s not supported\n", route.Path)
+			continue
+		}
+		if route.use {
+			uses = append(uses, route)
+			continue
+		}
+		// the middleware of the app matching the route runs after the group middleware,
+		// it is not registered globally so it never runs for the routes of the core
+		handlers := g.chain()
+		var params [maxParams]string
+		for _, use := range uses {
+			if use.match(route.path, route.Path, &params) {
+				handlers = append(handlers, use.Handlers...)
+			}
+		}
+		g.core.pushMethod(route.Method, joinPath(prefix, route.Path), append(handlers, route.Handlers...)...)
+	}
+	return g
+}
+
+// chain returns the group middleware followed by handlers
+func (g *Group) chain(handlers ...Hand) []Hand {
+	return appendHands(g.handlers, handlers...)
+}
+
+// joinPath join the route prefix and path
+func joinPath(prefix, p string) string {
+	return path.Join("/", prefix, p)
+}
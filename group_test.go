@@ -0,0 +1,79 @@
+package cola
+
+import (
+	"testing"
+)
+
+// trace appends name to the X-Trace response header and runs the next handler
+func trace(name string) Hand {
+	return func(c *Ctx) {
+		c.Append("X-Trace", name)
+		c.Next()
+	}
+}
+
+func TestGroupMountMiddleware(t *testing.T) {
+	sub := New()
+	sub.Use(trace("sub"))
+	sub.Use("/admin", trace("admin"))
+	sub.Add(MethodGet, "/page", func(c *Ctx) { c.SendString("page") })
+	sub.Add(MethodGet, "/admin/users", func(c *Ctx) { c.SendString("users") })
+
+	app := New()
+	app.Group("/blog", trace("group")).Mount("/", sub)
+	app.Add(MethodGet, "/blog-feed", func(c *Ctx) { c.SendString("feed") })
+	app.Add(MethodGet, "/blog/about", func(c *Ctx) { c.SendString("about") })
+	tc := NewTestClient(app)
+
+	for _, tt := range []struct{ path, trace string }{
+		{"/blog/page", "group, sub"},
+		{"/blog/admin/users", "group, sub, admin"},
+		{"/blog-feed", ""},
+		{"/blog/about", ""},
+	} {
+		if err := tc.Get(tt.path).Expect(StatusOK).ExpectHeader("X-Trace", tt.trace).Err(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+type groupHandler struct {
+	Handler
+}
+
+func (h *groupHandler) Preload(c *Ctx) {
+	c.Append("X-Trace", "preload")
+	c.Next()
+}
+
+func (h *groupHandler) GetInfo(c *Ctx) { c.SendString("info") }
+
+func TestGroup(t *testing.T) {
+	app := New()
+	api := app.Group("/api", trace("api"))
+	api.Get("/user", func(c *Ctx) { c.SendString("user") })
+	v1 := api.Group("v1", trace("v1"))
+	v1.Use(new(groupHandler))
+	v1.Post("/save", func(c *Ctx) { c.SendString("save") })
+	app.Add(MethodGet, "/api/other", func(c *Ctx) { c.SendString("other") })
+	tc := NewTestClient(app)
+
+	if api.Prefix() != "/api" || v1.Prefix() != "/api/v1" {
+		t.Fatalf("Prefix() = %s, %s", api.Prefix(), v1.Prefix())
+	}
+	for _, tt := range []struct{ method, path, body, trace string }{
+		{MethodGet, "/api/user", "user", "api"},
+		{MethodGet, "/api/v1/info", "info", "api, v1, preload"},
+		{MethodPost, "/api/v1/save", "save", "api, v1"},
+		{MethodGet, "/api/other", "other", ""},
+	} {
+		body, err := tc.Request(tt.method, tt.path).Expect(StatusOK).ExpectHeader("X-Trace", tt.trace).String()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if body != tt.body {
+			t.Errorf("%s %s = %q, want %q", tt.method, tt.path, body, tt.body)
+		}
+	}
+}
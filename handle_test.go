@@ -0,0 +1,47 @@
+package cola
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/xs23933/cola/log"
+)
+
+type shapeHandler struct {
+	Handler
+}
+
+func (h *shapeHandler) GetOk(c *Ctx)           { c.SendString("ok") }
+func (h *shapeHandler) GetBad(c *Ctx, id int)  {}
+func (h *shapeHandler) WsBad(c *Ctx)           {}
+func (h *shapeHandler) Helper(id int) int      { return id }
+func (h *shapeHandler) PostSave(c *Ctx) error  { return nil }
+func (h *shapeHandler) DeleteBad() interface{} { return nil }
+
+func TestBuildHandlesUnsupportedShape(t *testing.T) {
+	app := New()
+	buf := new(bytes.Buffer)
+	defer func(prev log.Interface) { Log = prev }(Log)
+	Log = log.NewLogger(buf, log.LevelWarn)
+	app.Use(new(shapeHandler))
+
+	out := buf.String()
+	for _, name := range []string{"shapeHandler.GetBad", "shapeHandler.WsBad", "shapeHandler.DeleteBad"} {
+		if !strings.Contains(out, name+" not registered") {
+			t.Errorf("no warning for %s in %q", name, out)
+		}
+	}
+	for _, name := range []string{"GetOk", "Helper", "PostSave"} {
+		if strings.Contains(out, "."+name+" ") {
+			t.Errorf("unexpected warning for %s in %q", name, out)
+		}
+	}
+	if !strings.Contains(out, "func(*cola.Ctx, *In) (Out, error)") {
+		t.Errorf("warning does not name the accepted shapes: %q", out)
+	}
+
+	if err := NewTestClient(app).Get("/ok").Expect(StatusOK).Err(); err != nil {
+		t.Fatal(err)
+	}
+}
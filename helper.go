@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"hash/crc32"
+	"html"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"unsafe"
 
@@ -213,22 +215,6 @@ func EqualFoldBytes(b, s []byte) (equals bool) {
 	return
 }
 
-// uniqueRouteStack drop all not unique routes from the slice
-func uniqueRouteStack(stack []*Route) []*Route {
-	var unique []*Route
-	m := make(map[*Route]int)
-	for _, v := range stack {
-		if _, ok := m[v]; !ok {
-			// Unique key found. Record position and collect
-			// in result.
-			m[v] = len(unique)
-			unique = append(unique, v)
-		}
-	}
-
-	return unique
-}
-
 // defaultString returns the value or a default value if it is set
 func defaultString(value string, defaultValue []string) string {
 	if len(value) == 0 && len(defaultValue) > 0 {
@@ -237,39 +223,23 @@ func defaultString(value string, defaultValue []string) string {
 	return value
 }
 
-// Scan stack if other methods match the request
-func methodExist(ctx *Ctx) (exist bool) {
+// allowMethods scan the stack for other methods which match the request path
+func allowMethods(ctx *Ctx) (methods []string) {
+	var tree []*Route
 	for i := 0; i < len(Methods); i++ {
 		// Skip original method
 		if ctx.methodINT == i {
 			continue
 		}
-		// Reset stack index
-		ctx.index = -1
-		tree, ok := ctx.Core.treeStack[i][ctx.treePath]
-		if !ok {
-			tree = ctx.Core.treeStack[i][""]
-		}
-		// Get stack length
-		lenr := len(tree) - 1
-		//Loop over the route stack starting from previous index
-		for ctx.index < lenr {
-			// Increment route index
-			ctx.index++
-			// Get *Route
-			route := tree[ctx.index]
+		tree = ctx.Core.trees()[i].find(ctx.detectionPath, tree[:0])
+		for _, route := range tree {
 			// Skip use routes
 			if route.use {
 				continue
 			}
 			// Check if it matches the request path
-			match := route.match(ctx.detectionPath, ctx.path, &ctx.values)
-			// No match, next route
-			if match {
-				// We matched
-				exist = true
-				// Add method to Allow header
-				ctx.Append(HeaderAllow, Methods[i])
+			if route.match(ctx.detectionPath, ctx.path, &ctx.values) {
+				methods = append(methods, Methods[i])
 				// Break stack loop
 				break
 			}
@@ -282,8 +252,8 @@ const normalizedHeaderETag = "Etag"
 
 // Generate and set ETag header to response
 func setETag(c *Ctx, weak bool) {
-	// Don't generate ETags for invalid responses
-	if c.Response.StatusCode() != StatusOK {
+	// Don't generate ETags for invalid or streamed responses
+	if c.Response.StatusCode() != StatusOK || c.Response.IsBodyStream() {
 		return
 	}
 	body := c.Response.Body()
@@ -298,8 +268,8 @@ func setETag(c *Ctx, weak bool) {
 	crc32q := crc32.MakeTable(0xD5828281)
 	etag := fmt.Sprintf("\"%d-%v\"", len(body), crc32.Checksum(body, crc32q))
 
-	// Enable weak tag
-	if weak {
+	// Enable weak tag, a encoded body is not byte identical to the resource
+	if weak || len(c.Response.Header.Peek(HeaderContentEncoding)) > 0 {
 		etag = "W/" + etag
 	}
 
@@ -747,6 +717,8 @@ var mimeExtensions = map[string]string{
 	"war":     "application/java-archive",
 	"ear":     "application/java-archive",
 	"json":    "application/json",
+	"yaml":    "application/yaml",
+	"yml":     "application/yaml",
 	"hqx":     "application/mac-binhex40",
 	"doc":     "application/msword",
 	"pdf":     "application/pdf",
@@ -829,16 +801,19 @@ const (
 	MIMETextPlain             = "text/plain"
 	MIMEApplicationXML        = "application/xml"
 	MIMEApplicationJSON       = "application/json"
+	MIMEApplicationYAML       = "application/yaml"
 	MIMEApplicationJavaScript = "application/javascript"
 	MIMEApplicationForm       = "application/x-www-form-urlencoded"
 	MIMEOctetStream           = "application/octet-stream"
 	MIMEMultipartForm         = "multipart/form-data"
+	MIMETextEventStream       = "text/event-stream"
 
 	MIMETextXMLCharsetUTF8               = "text/xml; charset=utf-8"
 	MIMETextHTMLCharsetUTF8              = "text/html; charset=utf-8"
 	MIMETextPlainCharsetUTF8             = "text/plain; charset=utf-8"
 	MIMEApplicationXMLCharsetUTF8        = "application/xml; charset=utf-8"
 	MIMEApplicationJSONCharsetUTF8       = "application/json; charset=utf-8"
+	MIMEApplicationYAMLCharsetUTF8       = "application/yaml; charset=utf-8"
 	MIMEApplicationJavaScriptCharsetUTF8 = "application/javascript; charset=utf-8"
 )
 
@@ -936,6 +911,37 @@ func NewError(code int, message ...string) *Error {
 	return e
 }
 
+// DefaultErrorHandler that process errors returned from handlers,
+// the status code is taken from *Error, 422 for *ValidationError and defaults to 500.
+// The response is rendered as html or plain text when the client prefers them,
+// otherwise by Ctx.Format in the same format as Ctx.ToJSON
+func DefaultErrorHandler(c *Ctx, err error) error {
+	code := StatusInternalServerError
+	switch e := err.(type) {
+	case *Error:
+		code = e.Code
+	case *ValidationError:
+		code = StatusUnprocessableEntity
+	}
+	c.Status(code)
+	switch c.Accepts(MIMEApplicationJSON, MIMETextHTML, MIMETextPlain) {
+	case MIMETextHTML:
+		c.Response.Header.SetContentType(MIMETextHTMLCharsetUTF8)
+		return c.SendString(errorHTML(code, err.Error()))
+	case MIMETextPlain:
+		c.Response.Header.SetContentType(MIMETextPlainCharsetUTF8)
+		return c.SendString(err.Error())
+	}
+	return c.Format(result(nil, err))
+}
+
+// errorHTML build a simple html error page
+func errorHTML(code int, msg string) string {
+	title := strconv.Itoa(code) + " " + StatusMessage(code)
+	return "<!DOCTYPE html><html><head><meta charset=\"utf-8\"><title>" + title + "</title></head><body><h1>" +
+		title + "</h1><p>" + html.EscapeString(msg) + "</p></body></html>"
+}
+
 // Errors
 var (
 	ErrBadRequest                    = NewError(StatusBadRequest)                    // RFC 7231, 6.5.1
@@ -1101,6 +1107,12 @@ const (
 	HeaderXDNSPrefetchControl             = "X-DNS-Prefetch-Control"
 	HeaderXPingback                       = "X-Pingback"
 	HeaderXRequestID                      = "X-Request-ID"
+	HeaderXAccelBuffering                 = "X-Accel-Buffering"
+	HeaderXCSRFToken                      = "X-CSRF-Token"
+	HeaderXCache                          = "X-Cache"
+	HeaderXRateLimitLimit                 = "X-RateLimit-Limit"
+	HeaderXRateLimitRemaining             = "X-RateLimit-Remaining"
+	HeaderXRateLimitReset                 = "X-RateLimit-Reset"
 	HeaderXRequestedWith                  = "X-Requested-With"
 	HeaderXRobotsTag                      = "X-Robots-Tag"
 	HeaderXUACompatible                   = "X-UA-Compatible"
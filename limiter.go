@@ -0,0 +1,264 @@
+package cola
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limiter algorithms
+const (
+	// LimiterSlidingWindow counts the requests of the current window
+	// and a weighted part of the previous window
+	LimiterSlidingWindow = "sliding-window"
+	// LimiterTokenBucket refills Max tokens every Expiration,
+	// bursts up to Max requests are allowed
+	LimiterTokenBucket = "token-bucket"
+)
+
+// LimiterConfig config of the Limiter middleware
+type LimiterConfig struct {
+	// Max number of requests of a key during Expiration.
+	// Optional. Default value 60.
+	Max int `json:"max"`
+
+	// Duration of the window, or the time to refill the token bucket.
+	// Optional. Default value 1 * time.Minute.
+	Expiration time.Duration `json:"expiration"`
+
+	// LimiterSlidingWindow or LimiterTokenBucket.
+	// Optional. Default value LimiterSlidingWindow.
+	Algorithm string `json:"algorithm"`
+
+	// KeyGenerator returns the key of the request,
+	// e.g. the user id from Vars.
+	// Optional. Default value the client IP, see Ctx.IP.
+	KeyGenerator func(*Ctx) string `json:"-"`
+
+	// LimitReached is called when the limit is reached.
+	// Optional. Default value returns ErrTooManyRequests.
+	LimitReached HandErr `json:"-"`
+
+	// Storage of the counters. The default MemoryStorage is per process,
+	// with Prefork every child counts its own requests so a client gets
+	// up to Max requests per child, an error is logged by every child on its
+	// first request. Use a shared storage implementing StorageUpdater
+	// to limit over prefork children or servers, without StorageUpdater
+	// the read and write of a key is only atomic in the process.
+	// Optional. Default value NewMemoryStorage().
+	Storage Storage `json:"-"`
+
+	// Next skips the middleware when it returns true.
+	// Optional. Default value nil.
+	Next func(*Ctx) bool `json:"-"`
+}
+
+// Limiter returns the rate limiting middleware.
+// The X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset headers are set,
+// a limited request gets a Retry-After header and a 429 response.
+//
+//	app.Use(cola.Limiter(cola.LimiterConfig{
+//		Max:        100,
+//		Expiration: time.Minute,
+//		Algorithm:  cola.LimiterTokenBucket,
+//	}))
+func Limiter(config ...LimiterConfig) Hand {
+	cfg := LimiterConfig{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.Max <= 0 {
+		cfg.Max = 60
+	}
+	if cfg.Expiration <= 0 {
+		cfg.Expiration = time.Minute
+	}
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = LimiterSlidingWindow
+	}
+	if cfg.KeyGenerator == nil {
+		cfg.KeyGenerator = limiterKey
+	}
+	if cfg.LimitReached == nil {
+		cfg.LimitReached = func(c *Ctx) error {
+			return ErrTooManyRequests
+		}
+	}
+	if cfg.Storage == nil {
+		cfg.Storage = NewMemoryStorage()
+	}
+
+	var take func(state []byte, now time.Time) (bool, limiterResult)
+	switch cfg.Algorithm {
+	case LimiterSlidingWindow:
+		take = cfg.slidingWindow
+	case LimiterTokenBucket:
+		take = cfg.tokenBucket
+	default:
+		panic("cola: unknown limiter algorithm " + cfg.Algorithm)
+	}
+	max := strconv.Itoa(cfg.Max)
+	updater, canUpdate := cfg.Storage.(StorageUpdater)
+	// Without StorageUpdater the read and write of a key is atomic in the process
+	var mu sync.Mutex
+	_, inProcess := cfg.Storage.(*MemoryStorage)
+	var preforkOnce sync.Once
+
+	return HandErr(func(c *Ctx) error {
+		if inProcess && c.Core.Prefork {
+			preforkOnce.Do(func() {
+				Log.Error("Limiter: MemoryStorage is not shared by the prefork children, "+
+					"every child allows %d requests, use a shared Storage\n", cfg.Max)
+			})
+		}
+		if cfg.Next != nil && cfg.Next(c) {
+			c.Next()
+			return nil
+		}
+		key := "limiter:" + cfg.KeyGenerator(c)
+
+		var (
+			allowed bool
+			res     limiterResult
+			err     error
+		)
+		if canUpdate {
+			err = updater.Update(key, func(state []byte) ([]byte, time.Duration) {
+				allowed, res = take(state, time.Now())
+				return res.state, res.exp
+			})
+		} else {
+			mu.Lock()
+			var state []byte
+			if state, err = cfg.Storage.Get(key); err == nil {
+				allowed, res = take(state, time.Now())
+				err = cfg.Storage.Set(key, res.state, res.exp)
+			}
+			mu.Unlock()
+		}
+		if err != nil {
+			return err
+		}
+
+		c.Set(HeaderXRateLimitLimit, max)
+		c.Set(HeaderXRateLimitRemaining, strconv.Itoa(res.remaining))
+		c.Set(HeaderXRateLimitReset, strconv.Itoa(seconds(res.reset)))
+		if !allowed {
+			c.Set(HeaderRetryAfter, strconv.Itoa(seconds(res.retry)))
+			return cfg.LimitReached(c)
+		}
+		c.Next()
+		return nil
+	}).Hand()
+}
+
+// limiterResult of a request
+type limiterResult struct {
+	state     []byte        // new state of the key
+	exp       time.Duration // expiration of the state
+	remaining int           // requests left
+	reset     time.Duration // time until the limit is fully reset
+	retry     time.Duration // time until the next request is allowed
+}
+
+// slidingWindow state: start of the current window, count of the current
+// and the previous window
+func (cfg *LimiterConfig) slidingWindow(state []byte, now time.Time) (bool, limiterResult) {
+	window := int64(cfg.Expiration)
+	start := now.UnixNano() / window * window
+	var curr, prev int64
+	if len(state) == 24 {
+		last := int64(binary.BigEndian.Uint64(state))
+		switch last {
+		case start:
+			curr = int64(binary.BigEndian.Uint64(state[8:]))
+			prev = int64(binary.BigEndian.Uint64(state[16:]))
+		case start - window:
+			prev = int64(binary.BigEndian.Uint64(state[8:]))
+		}
+	}
+
+	elapsed := now.UnixNano() - start
+	weight := float64(window-elapsed) / float64(window)
+	max := float64(cfg.Max)
+	count := float64(prev)*weight + float64(curr)
+
+	res := limiterResult{exp: 2 * cfg.Expiration}
+	allowed := count+1 <= max
+	if allowed {
+		curr++
+		count++
+	} else if float64(curr) < max {
+		// prev > 0, wait for prev*weight + curr + 1 <= max in this window
+		res.retry = time.Duration(float64(window)*(1-(max-1-float64(curr))/float64(prev))) - time.Duration(elapsed)
+	} else {
+		// the full window becomes the previous window of the next one,
+		// wait for curr*weight + 1 <= max in the next window
+		res.retry = time.Duration(window-elapsed) + time.Duration(float64(window)*(1-(max-1)/float64(curr)))
+	}
+	if !allowed {
+		// round up, the weight at the exact time may be off by the float precision
+		res.retry = res.retry.Truncate(time.Millisecond) + time.Millisecond
+	}
+	res.remaining = int(max - count)
+	if res.remaining < 0 {
+		res.remaining = 0
+	}
+	res.reset = time.Duration(window - elapsed)
+	if curr > 0 {
+		res.reset += time.Duration(window)
+	}
+
+	res.state = make([]byte, 24)
+	binary.BigEndian.PutUint64(res.state, uint64(start))
+	binary.BigEndian.PutUint64(res.state[8:], uint64(curr))
+	binary.BigEndian.PutUint64(res.state[16:], uint64(prev))
+	return allowed, res
+}
+
+// tokenBucket state: tokens left and the time of the last refill
+func (cfg *LimiterConfig) tokenBucket(state []byte, now time.Time) (bool, limiterResult) {
+	capacity := float64(cfg.Max)
+	rate := capacity / float64(cfg.Expiration) // tokens per nanosecond
+	tokens := capacity
+	if len(state) == 16 {
+		tokens = math.Float64frombits(binary.BigEndian.Uint64(state))
+		last := int64(binary.BigEndian.Uint64(state[8:]))
+		tokens = math.Min(capacity, tokens+float64(now.UnixNano()-last)*rate)
+	}
+
+	res := limiterResult{exp: cfg.Expiration}
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	} else {
+		res.retry = time.Duration((1 - tokens) / rate)
+	}
+	res.remaining = int(tokens)
+	res.reset = time.Duration((capacity - tokens) / rate)
+
+	res.state = make([]byte, 16)
+	binary.BigEndian.PutUint64(res.state, math.Float64bits(tokens))
+	binary.BigEndian.PutUint64(res.state[8:], uint64(now.UnixNano()))
+	return allowed, res
+}
+
+// limiterKey returns the client IP, the first address of the ProxyHeader
+func limiterKey(c *Ctx) string {
+	ip := c.IP()
+	if i := strings.IndexByte(ip, ','); i >= 0 {
+		ip = strings.TrimSpace(ip[:i])
+	}
+	if ip == "" {
+		ip = c.RemoteIP().String()
+	}
+	return ip
+}
+
+// seconds rounds d up to whole seconds
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,178 @@
+package cola
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xs23933/cola/log"
+)
+
+func TestLimiter(t *testing.T) {
+	app := New()
+	app.Use(Limiter(LimiterConfig{Max: 2, Expiration: time.Minute}))
+	app.Add(MethodGet, "/", func(c *Ctx) { c.SendString("ok") })
+	tc := NewTestClient(app)
+
+	for _, remaining := range []string{"1", "0"} {
+		if err := tc.Get("/").Expect(StatusOK).
+			ExpectHeader(HeaderXRateLimitLimit, "2").ExpectHeader(HeaderXRateLimitRemaining, remaining).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, err := tc.Get("/").Expect(StatusTooManyRequests).Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get(HeaderRetryAfter) == "" {
+		t.Fatal("missing Retry-After")
+	}
+}
+
+// sharedStorage stands for a storage shared by the prefork children
+type sharedStorage struct {
+	*MemoryStorage
+}
+
+func TestLimiterPreforkMemoryStorage(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		storage Storage
+		logged  int
+	}{
+		{"default", nil, 1},
+		{"memory", NewMemoryStorage(), 1},
+		{"shared", sharedStorage{NewMemoryStorage()}, 0},
+	} {
+		app := New(&Options{Prefork: true})
+		buf := new(bytes.Buffer)
+		defer func(prev log.Interface) { Log = prev }(Log)
+		Log = log.NewLogger(buf, log.LevelError)
+		app.Use(Limiter(LimiterConfig{Storage: tt.storage}))
+		app.Add(MethodGet, "/", func(c *Ctx) { c.SendString("ok") })
+		tc := NewTestClient(app)
+
+		for i := 0; i < 2; i++ {
+			if err := tc.Get("/").Expect(StatusOK).Err(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n := strings.Count(buf.String(), "not shared by the prefork children"); n != tt.logged {
+			t.Errorf("%s: logged %d times, want %d: %q", tt.name, n, tt.logged, buf.String())
+		}
+	}
+}
+
+// TestLimiterSlidingWindowRetry checks a request is allowed after Retry-After
+func TestLimiterSlidingWindowRetry(t *testing.T) {
+	cfg := LimiterConfig{Max: 3, Expiration: 10 * time.Second}
+	start := time.Unix(0, 0).Add(1000 * cfg.Expiration)
+
+	for _, tt := range []struct {
+		name     string
+		requests []time.Duration // allowed requests since start
+		at       time.Duration   // the limited request
+	}{
+		{"full current window", []time.Duration{1 * time.Second, 2 * time.Second, 3 * time.Second}, 4 * time.Second},
+		{"weighted previous window", []time.Duration{time.Second, 2 * time.Second, 12 * time.Second}, 13 * time.Second},
+	} {
+		var state []byte
+		for _, at := range tt.requests {
+			allowed, res := cfg.slidingWindow(state, start.Add(at))
+			if !allowed {
+				t.Fatalf("%s: request at %v not allowed", tt.name, at)
+			}
+			state = res.state
+		}
+		allowed, res := cfg.slidingWindow(state, start.Add(tt.at))
+		if allowed || res.retry <= 0 {
+			t.Fatalf("%s: request at %v allowed, retry %v", tt.name, tt.at, res.retry)
+		}
+		if allowed, _ = cfg.slidingWindow(state, start.Add(tt.at+res.retry-10*time.Millisecond)); allowed {
+			t.Fatalf("%s: request allowed before Retry-After %v", tt.name, res.retry)
+		}
+		if allowed, _ = cfg.slidingWindow(state, start.Add(tt.at+res.retry)); !allowed {
+			t.Fatalf("%s: request not allowed after Retry-After %v", tt.name, res.retry)
+		}
+	}
+}
+
+func TestLimiterTokenBucket(t *testing.T) {
+	cfg := LimiterConfig{Max: 3, Expiration: 3 * time.Second, Algorithm: LimiterTokenBucket}
+	start := time.Unix(1000, 0)
+
+	var state []byte
+	for i, at := range []time.Duration{0, 0, 0, 0, time.Second, time.Second} {
+		allowed, res := cfg.tokenBucket(state, start.Add(at))
+		// a token is refilled every second
+		if want := i < 3 || i == 4; allowed != want {
+			t.Fatalf("request %d at %v allowed %v, want %v", i, at, allowed, want)
+		}
+		if !allowed && seconds(res.retry) != 1 {
+			t.Fatalf("request %d at %v: Retry-After %d, want 1", i, at, seconds(res.retry))
+		}
+		state = res.state
+	}
+}
+
+func TestLimiterProxyHeader(t *testing.T) {
+	app := New(&Options{ProxyHeader: HeaderXForwardedFor})
+	app.Use(Limiter(LimiterConfig{Max: 1}))
+	app.Add(MethodGet, "/", func(c *Ctx) { c.SendString("ok") })
+	tc := NewTestClient(app)
+
+	for _, tt := range []struct {
+		forwarded string
+		status    int
+	}{
+		{"1.1.1.1, 2.2.2.2", StatusOK},
+		{"1.1.1.1", StatusTooManyRequests},
+		{"3.3.3.3, 2.2.2.2", StatusOK},
+	} {
+		if err := tc.Get("/").Header(HeaderXForwardedFor, tt.forwarded).Expect(tt.status).Err(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// getSetStorage hides the Update of MemoryStorage
+type getSetStorage struct {
+	Storage
+}
+
+func TestLimiterConcurrent(t *testing.T) {
+	for _, storage := range []Storage{NewMemoryStorage(), getSetStorage{NewMemoryStorage()}} {
+		app := New()
+		app.Use(Limiter(LimiterConfig{Max: 10, Storage: storage}))
+		app.Add(MethodGet, "/", func(c *Ctx) { c.SendString("ok") })
+		tc := NewTestClient(app)
+
+		var (
+			wg sync.WaitGroup
+			mu sync.Mutex
+			ok int
+		)
+		for i := 0; i < 30; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := tc.Get("/").Response()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if resp.StatusCode == StatusOK {
+					mu.Lock()
+					ok++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if ok != 10 {
+			t.Fatalf("%T: %d requests allowed, want 10", storage, ok)
+		}
+	}
+}
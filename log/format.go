@@ -0,0 +1,137 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// IsTerminal reports whether w is a terminal
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// write print a line of the json or logfmt format:
+// time, level, msg, caller, the key value pairs kv and the With fields
+func (l logger) write(level, msg string, caller bool, data []interface{}, kv ...interface{}) {
+	if len(data) > 0 {
+		msg = fmt.Sprintf(msg, data...)
+	}
+	msg = strings.TrimRight(msg, "\n")
+
+	pairs := make([]interface{}, 0, 8+len(kv)+len(l.fields))
+	pairs = append(pairs, "time", time.Now().Format(time.RFC3339Nano), "level", level, "msg", msg)
+	if caller {
+		pairs = append(pairs, "caller", FileWithLineNum())
+	}
+	pairs = append(pairs, kv...)
+	pairs = append(pairs, l.fields...)
+
+	var b strings.Builder
+	if l.Format == FormatJSON {
+		b.WriteByte('{')
+		for i := 0; i < len(pairs); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			appendJSON(&b, pairs[i], pairs[i+1])
+		}
+		b.WriteByte('}')
+	} else {
+		for i := 0; i < len(pairs); i += 2 {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			appendLogfmt(&b, pairs[i], pairs[i+1])
+		}
+	}
+	b.WriteByte('\n')
+
+	if l.out == nil {
+		l.Writer.Printf("%s", b.String())
+		return
+	}
+	l.mu.Lock()
+	_, _ = io.WriteString(l.out, b.String())
+	l.mu.Unlock()
+}
+
+// appendJSON append "key":value
+func appendJSON(b *strings.Builder, key, val interface{}) {
+	k, _ := json.Marshal(fmt.Sprint(key))
+	b.Write(k)
+	b.WriteByte(':')
+	switch v := val.(type) {
+	case error:
+		val = v.Error()
+	case time.Duration:
+		val = v.String()
+	case fmt.Stringer:
+		val = v.String()
+	}
+	raw, err := json.Marshal(val)
+	if err != nil {
+		raw, _ = json.Marshal(fmt.Sprint(val))
+	}
+	b.Write(raw)
+}
+
+// appendLogfmt append key=value, the value is quoted when needed
+func appendLogfmt(b *strings.Builder, key, val interface{}) {
+	b.WriteString(logfmtKey(fmt.Sprint(key)))
+	b.WriteByte('=')
+	var s string
+	switch v := val.(type) {
+	case nil:
+		s = "null"
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if needsQuote(s) {
+		s = strconv.Quote(s)
+	}
+	b.WriteString(s)
+}
+
+// logfmtKey removes the characters not allowed in a key
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+func needsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError {
+			return true
+		}
+	}
+	return false
+}
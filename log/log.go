@@ -9,6 +9,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
@@ -65,11 +66,24 @@ type Writer interface {
 	Printf(string, ...interface{})
 }
 
+// Log formats
+const (
+	// FormatText printf style lines, fields are appended as key=value
+	FormatText = "text"
+	// FormatJSON one json object per line
+	FormatJSON = "json"
+	// FormatLogfmt one line of key=value pairs
+	FormatLogfmt = "logfmt"
+)
+
 // Config log config
 type Config struct {
 	SlowThreshold time.Duration
-	Colorful      bool
-	LogLevel      LogLevel
+	// Colorful is turned off when the writer is not a terminal
+	Colorful bool
+	LogLevel LogLevel
+	// FormatText, FormatJSON or FormatLogfmt, default FormatText
+	Format string
 }
 
 // Interface logger interface
@@ -83,6 +97,8 @@ type Interface interface {
 	Warn(string, ...interface{})
 	Error(string, ...interface{})
 	Trace(time.Time, func() (string, int64), error)
+	// With returns a logger adding the key value pairs to every message
+	With(keyvals ...interface{}) Interface
 }
 
 var (
@@ -94,21 +110,25 @@ var (
 	})
 )
 
-// NewLogger New Logger engine
-func NewLogger(out io.Writer, level LogLevel) Interface {
-	return New(log.New(out, " ", log.LstdFlags), Config{
+// NewLogger New Logger engine, format default FormatText
+func NewLogger(out io.Writer, level LogLevel, format ...string) Interface {
+	config := Config{
 		SlowThreshold: 200 * time.Millisecond,
 		LogLevel:      level,
 		Colorful:      true,
-	})
+	}
+	if len(format) > 0 {
+		config.Format = format[0]
+	}
+	return New(log.New(out, " ", log.LstdFlags), config)
 }
 
 // New new log interface
 func New(writer Writer, config Config) Interface {
 	var (
 		debugStr     = "%s\n[debug] "
-		infoStr      = "%s\n[info] "
-		logStr       = "%s\n[debug] "
+		infoStr      = "[info] "
+		logStr       = "[debug] "
 		warnStr      = "%s\n[warn] "
 		errStr       = "%s\n[error] "
 		traceStr     = "%s\n[%.3fms] [rows:%v] %s"
@@ -116,6 +136,21 @@ func New(writer Writer, config Config) Interface {
 		traceErrStr  = "%s %s\n[%.3fms] [rows:%v] %s"
 	)
 
+	// The structured formats write lines to the writer of a *log.Logger
+	var out io.Writer
+	switch w := writer.(type) {
+	case *log.Logger:
+		out = w.Writer()
+	case io.Writer:
+		out = w
+	}
+	if config.Format == "" {
+		config.Format = FormatText
+	}
+	if config.Format != FormatText || out != nil && !IsTerminal(out) {
+		config.Colorful = false
+	}
+
 	if config.Colorful {
 		debugStr = Cyan + "%s\n" + Reset + Green + "[debug] " + Reset
 		infoStr = Green + Reset + Green + "[info] " + Reset
@@ -130,6 +165,8 @@ func New(writer Writer, config Config) Interface {
 	return &logger{
 		Writer:       writer,
 		Config:       config,
+		out:          out,
+		mu:           new(sync.Mutex),
 		debugStr:     debugStr,
 		infoStr:      infoStr,
 		logStr:       logStr,
@@ -144,6 +181,10 @@ func New(writer Writer, config Config) Interface {
 type logger struct {
 	Writer
 	Config
+	out    io.Writer
+	mu     *sync.Mutex   // shared by the loggers of With
+	fields []interface{} // key value pairs of With
+
 	debugStr, infoStr, logStr, warnStr, errStr string
 	traceStr, traceErrStr, traceWarnStr        string
 }
@@ -155,27 +196,42 @@ func (l *logger) LogMode(level LogLevel) Interface {
 	return &newlogger
 }
 
+// With returns a logger adding the key value pairs to every message
+func (l *logger) With(keyvals ...interface{}) Interface {
+	if len(keyvals)%2 == 1 {
+		keyvals = append(keyvals, "(MISSING)")
+	}
+	newlogger := *l
+	newlogger.fields = append(l.fields[:len(l.fields):len(l.fields)], keyvals...)
+	return &newlogger
+}
+
 // Info print info
 func (l logger) Debug(msg string, data ...interface{}) {
 	if l.LogLevel >= LevelDebug {
-		l.Printf(l.debugStr+msg, append([]interface{}{FileWithLineNum()}, data...)...)
+		l.log("debug", l.debugStr, true, msg, data)
 	}
 }
 
 // Info print info
 func (l logger) Info(msg string, data ...interface{}) {
 	if l.LogLevel >= LevelWarn {
-		l.Printf(l.infoStr+msg, data...)
+		l.log("info", l.infoStr, false, msg, data)
 	}
 }
 
 // Log print Log
 func (l logger) D(msg string, data ...interface{}) {
 	if l.LogLevel >= LevelDebug {
-		l.Printf(l.logStr+msg, data...)
+		l.log("debug", l.logStr, false, msg, data)
 	}
 }
 
+// Printf print the message whatever the level
+func (l logger) Printf(msg string, data ...interface{}) {
+	l.log("info", "", false, msg, data)
+}
+
 func (l logger) Dump(dat ...interface{}) {
 	spew.Dump(dat...)
 }
@@ -183,14 +239,14 @@ func (l logger) Dump(dat ...interface{}) {
 // Warn print warn messages
 func (l logger) Warn(msg string, data ...interface{}) {
 	if l.LogLevel >= LevelWarn {
-		l.Printf(l.warnStr+msg, append([]interface{}{FileWithLineNum()}, data...)...)
+		l.log("warn", l.warnStr, true, msg, data)
 	}
 }
 
 // Error print error messages
 func (l logger) Error(msg string, data ...interface{}) {
 	if l.LogLevel >= LevelError {
-		l.Printf(l.errStr+msg, append([]interface{}{FileWithLineNum()}, data...)...)
+		l.log("error", l.errStr, true, msg, data)
 	}
 }
 
@@ -198,29 +254,64 @@ func (l logger) Error(msg string, data ...interface{}) {
 func (l logger) Trace(begin time.Time, fc func() (string, int64), err error) {
 	if l.LogLevel > LevelSilent {
 		elapsed := time.Since(begin)
+		ms := float64(elapsed.Nanoseconds()) / 1e6
 		switch {
 		case err != nil && l.LogLevel >= LevelError:
 			sql, rows := fc()
-			if rows == -1 {
-				l.Printf(l.traceErrStr, FileWithLineNum(), err, float64(elapsed.Nanoseconds())/1e6, "-", sql)
+			if l.Format != FormatText {
+				l.write("error", "sql", true, nil, "error", err, "elapsed_ms", ms, "rows", rows, "sql", sql)
+			} else if rows == -1 {
+				l.text(l.traceErrStr, FileWithLineNum(), err, ms, "-", sql)
 			} else {
-				l.Printf(l.traceErrStr, FileWithLineNum(), err, float64(elapsed.Nanoseconds())/1e6, rows, sql)
+				l.text(l.traceErrStr, FileWithLineNum(), err, ms, rows, sql)
 			}
 		case elapsed > l.SlowThreshold && l.SlowThreshold != 0 && l.LogLevel >= LevelWarn:
 			sql, rows := fc()
 			slowLog := fmt.Sprintf("SLOW  >= %v", l.SlowThreshold)
-			if rows == -1 {
-				l.Printf(l.traceWarnStr, FileWithLineNum(), slowLog, float64(elapsed.Nanoseconds())/1e6, "-", sql)
+			if l.Format != FormatText {
+				l.write("warn", "slow sql", true, nil, "threshold", l.SlowThreshold.String(), "elapsed_ms", ms, "rows", rows, "sql", sql)
+			} else if rows == -1 {
+				l.text(l.traceWarnStr, FileWithLineNum(), slowLog, ms, "-", sql)
 			} else {
-				l.Printf(l.traceWarnStr, FileWithLineNum(), slowLog, float64(elapsed.Nanoseconds())/1e6, rows, sql)
+				l.text(l.traceWarnStr, FileWithLineNum(), slowLog, ms, rows, sql)
 			}
 		case l.LogLevel == LevelInfo:
 			sql, rows := fc()
-			if rows == -1 {
-				l.Printf(l.traceStr, FileWithLineNum(), float64(elapsed.Nanoseconds())/1e6, "-", sql)
+			if l.Format != FormatText {
+				l.write("info", "sql", true, nil, "elapsed_ms", ms, "rows", rows, "sql", sql)
+			} else if rows == -1 {
+				l.text(l.traceStr, FileWithLineNum(), ms, "-", sql)
 			} else {
-				l.Printf(l.traceStr, FileWithLineNum(), float64(elapsed.Nanoseconds())/1e6, rows, sql)
+				l.text(l.traceStr, FileWithLineNum(), ms, rows, sql)
 			}
 		}
 	}
 }
+
+// log print the message in the format of the logger,
+// prefix is the printf prefix of the text format
+func (l logger) log(level, prefix string, caller bool, msg string, data []interface{}) {
+	if l.Format != FormatText {
+		l.write(level, msg, caller, data)
+		return
+	}
+	if caller {
+		data = append([]interface{}{FileWithLineNum()}, data...)
+	}
+	l.text(prefix+msg, data...)
+}
+
+// text print a line of the text format, followed by the With fields
+func (l logger) text(format string, data ...interface{}) {
+	if len(l.fields) == 0 {
+		l.Writer.Printf(format, data...)
+		return
+	}
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(fmt.Sprintf(format, data...), "\n"))
+	for i := 0; i < len(l.fields); i += 2 {
+		b.WriteByte(' ')
+		appendLogfmt(&b, l.fields[i], l.fields[i+1])
+	}
+	l.Writer.Printf("%s", b.String())
+}
@@ -0,0 +1,66 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLoggerFormats(t *testing.T) {
+	for _, tt := range []struct {
+		format string
+		want   []string
+	}{
+		{FormatText, []string{"[info] hello world", "[error] failed: boom user=1 name=\"a b\""}},
+		{FormatLogfmt, []string{"level=info msg=\"hello world\"", "level=error msg=\"failed: boom\" caller=", " user=1 name=\"a b\""}},
+		{FormatJSON, []string{`"level":"info","msg":"hello world"}`, `"level":"error","msg":"failed: boom","caller":`, `"user":1,"name":"a b"}`}},
+	} {
+		buf := new(bytes.Buffer)
+		l := NewLogger(buf, LevelInfo, tt.format)
+		l.Debug("hidden")
+		l.Info("hello %s", "world")
+		l.With("user", 1, "name", "a b").Error("failed: %v", errors.New("boom"))
+
+		out := buf.String()
+		for _, want := range tt.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s: %q does not contain %q", tt.format, out, want)
+			}
+		}
+		if strings.Contains(out, "hidden") {
+			t.Errorf("%s: debug message logged at info level: %q", tt.format, out)
+		}
+		if !strings.Contains(out, "log_test.go:") {
+			t.Errorf("%s: no caller in %q", tt.format, out)
+		}
+		if tt.format != FormatJSON {
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			var m map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &m); err != nil {
+				t.Errorf("json line %q: %v", line, err)
+			}
+		}
+	}
+}
+
+func TestLoggerWith(t *testing.T) {
+	buf := new(bytes.Buffer)
+	base := NewLogger(buf, LevelInfo, FormatLogfmt)
+	base.With("a", 1).With("b", 2).Info("first")
+	base.Info("second")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines = %q", lines)
+	}
+	if !strings.HasSuffix(lines[0], "msg=first a=1 b=2") {
+		t.Errorf("With() line = %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], "msg=second") {
+		t.Errorf("With() changed the parent logger: %q", lines[1])
+	}
+}
@@ -0,0 +1,251 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat time in the name of the rotated files, sorts by name
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateConfig rotation and retention of a RotateWriter
+type RotateConfig struct {
+	// Rotate when the file gets bigger than MaxSize megabytes.
+	// Optional. Default value 0, no size rotation.
+	MaxSize int `json:"max_size"`
+
+	// Rotate when the day changes.
+	// Optional. Default value false.
+	Daily bool `json:"daily"`
+
+	// Remove the rotated files older than MaxAge.
+	// Optional. Default value 0, files are kept.
+	MaxAge time.Duration `json:"max_age"`
+
+	// Keep at most MaxBackups rotated files.
+	// Optional. Default value 0, files are kept.
+	MaxBackups int `json:"max_backups"`
+
+	// gzip the rotated files.
+	// Optional. Default value false.
+	Compress bool `json:"compress"`
+}
+
+// RotateWriter is a io.Writer appending to a file,
+// rotated by size and day to name-<time>.ext, like app-2021-01-02T15-04-05.000.log
+type RotateWriter struct {
+	filename string
+	config   RotateConfig
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	day    int // year day of the file
+	closed bool
+
+	cleanMu sync.Mutex // serialize compress and retention
+}
+
+// NewRotateWriter open filename for appending, the directory is created
+func NewRotateWriter(filename string, config ...RotateConfig) (*RotateWriter, error) {
+	w := &RotateWriter{filename: filename}
+	if len(config) > 0 {
+		w.config = config[0]
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, err
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Filename returns the path of the current file
+func (w *RotateWriter) Filename() string {
+	return w.filename
+}
+
+// Write implements io.Writer, the file is rotated first when needed
+func (w *RotateWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.file == nil {
+		if err = w.open(); err != nil {
+			return 0, err
+		}
+	}
+	max := int64(w.config.MaxSize) * 1024 * 1024
+	if max > 0 && w.size > 0 && w.size+int64(len(p)) > max ||
+		w.config.Daily && time.Now().YearDay() != w.day {
+		if err = w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err = w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate the file now
+func (w *RotateWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.rotate()
+}
+
+// Reopen close and open the file again,
+// call it after the file was moved by an external tool like logrotate
+func (w *RotateWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	if w.file != nil {
+		_ = w.file.Close()
+		w.file = nil
+	}
+	return w.open()
+}
+
+// Close the file
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *RotateWriter) open() error {
+	f, err := os.OpenFile(w.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	w.day = info.ModTime().YearDay()
+	if info.Size() == 0 {
+		w.day = time.Now().YearDay()
+	}
+	return nil
+}
+
+// rotate rename the file and open a new one, w.mu is held
+func (w *RotateWriter) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+	ext := filepath.Ext(w.filename)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(w.filename, ext), time.Now().Format(backupTimeFormat), ext)
+	if err := os.Rename(w.filename, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	go w.cleanup(backup)
+	return nil
+}
+
+// cleanup compress the rotated file and remove the old files
+func (w *RotateWriter) cleanup(backup string) {
+	w.cleanMu.Lock()
+	defer w.cleanMu.Unlock()
+	if w.config.Compress {
+		if err := gzipFile(backup); err != nil {
+			fmt.Fprintf(os.Stderr, "log: compress %s: %v\n", backup, err)
+		}
+	}
+	if w.config.MaxAge <= 0 && w.config.MaxBackups <= 0 {
+		return
+	}
+
+	dir := filepath.Dir(w.filename)
+	ext := filepath.Ext(w.filename)
+	prefix := strings.TrimSuffix(filepath.Base(w.filename), ext) + "-"
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	modTime := make(map[string]time.Time)
+	var backups []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		ts := strings.TrimSuffix(strings.TrimSuffix(name[len(prefix):], ".gz"), ext)
+		if _, err := time.Parse(backupTimeFormat, ts); err != nil {
+			continue
+		}
+		backups = append(backups, name)
+		modTime[name] = e.ModTime()
+	}
+	// newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	cutoff := time.Now().Add(-w.config.MaxAge)
+	for i, name := range backups {
+		old := w.config.MaxBackups > 0 && i >= w.config.MaxBackups
+		if w.config.MaxAge > 0 && modTime[name].Before(cutoff) {
+			old = true
+		}
+		if old {
+			_ = os.Remove(filepath.Join(dir, name))
+		}
+	}
+}
+
+// gzipFile compress name to name.gz and remove name
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err == nil {
+		err = gz.Close()
+	}
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		_ = os.Remove(name + ".gz")
+		return err
+	}
+	src.Close()
+	return os.Remove(name)
+}
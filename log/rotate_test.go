@@ -0,0 +1,82 @@
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backups returns the rotated files of dir, waiting for the cleanup to settle on n files
+func backups(t *testing.T, dir string, n int) []string {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), "app-") && strings.HasSuffix(e.Name(), ".log.gz") {
+				names = append(names, e.Name())
+			}
+		}
+		if len(names) == n && len(entries) == n+1 || time.Now().After(deadline) {
+			return names
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRotateWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cola-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "sub", "app.log")
+	w, err := NewRotateWriter(name, RotateConfig{MaxSize: 1, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	line := []byte(strings.Repeat("x", 1023) + "\n")
+	for i := 0; i < 1024*3+1; i++ {
+		if _, err = w.Write(line); err != nil {
+			t.Fatal(err)
+		}
+		if i%1024 == 0 {
+			// a new millisecond for the name of the next backup
+			time.Sleep(2 * time.Millisecond)
+		}
+	}
+	if got := backups(t, filepath.Dir(name), 2); len(got) != 2 {
+		t.Fatalf("backups = %v, want 2", got)
+	}
+	if info, err := os.Stat(name); err != nil || info.Size() != int64(len(line)) {
+		t.Fatalf("current file = %v, %v", info, err)
+	}
+
+	// moved by logrotate
+	if err = os.Rename(name, filepath.Join(dir, "moved.log")); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("before\n"))
+	if err = w.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("after\n"))
+	if b, _ := ioutil.ReadFile(name); string(b) != "after\n" {
+		t.Fatalf("after Reopen() file = %q", b)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(line); err != os.ErrClosed {
+		t.Fatalf("Write() after Close() = %v, want os.ErrClosed", err)
+	}
+}
@@ -0,0 +1,450 @@
+package cola
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/valyala/fasthttp/reuseport"
+)
+
+const (
+	envChildKey = "COLA_CHILD"
+	envChildVal = "1"
+	// position of the child, stable over restarts
+	envChildIDKey = "COLA_CHILD_ID"
+
+	// restart backoff of crashed children
+	preforkMinBackoff = 100 * time.Millisecond
+	preforkMaxBackoff = 10 * time.Second
+	// a child running longer than this resets the backoff
+	preforkStableTime = 30 * time.Second
+)
+
+// delay between the children of a rolling restart
+var preforkRollDelay = time.Second
+
+// PreforkChild status of a prefork child process
+type PreforkChild struct {
+	Pid      int
+	Restarts int       // times the child was restarted
+	Started  time.Time // start time of the current process
+	Running  bool
+	Err      error // exit error of the last process
+}
+
+// Uptime returns the running time of the current process
+func (p PreforkChild) Uptime() time.Duration {
+	if !p.Running {
+		return 0
+	}
+	return time.Since(p.Started)
+}
+
+// PreforkStatus returns the status of the prefork children,
+// it is only available in the prefork master process
+func (c *Core) PreforkStatus() []PreforkChild {
+	if c.supervisor == nil {
+		return nil
+	}
+	return c.supervisor.status()
+}
+
+// prefork start the child processes in the master and serve in the children
+func (c *Core) prefork(addr string, tlsConfig *tls.Config) (err error) {
+	if isChild() {
+		runtime.GOMAXPROCS(1)
+		var ln net.Listener
+		if ln, err = reuseport.Listen("tcp4", addr); err != nil {
+			return err
+		}
+
+		if tlsConfig != nil {
+			ln = tls.NewListener(ln, tlsConfig)
+		}
+
+		Go(c.watchMaster)
+
+		if err = c.Server.Serve(ln); err != nil {
+			return err
+		}
+		// wait for the connections to drain
+		<-c.stopped
+		return nil
+	}
+
+	c.supervisor = &supervisor{
+		core: c,
+		stop: make(chan struct{}),
+		args: os.Args,
+	}
+	return c.supervisor.run()
+}
+
+func isChild() bool {
+	return os.Getenv(envChildKey) == envChildVal
+}
+
+// watchMaster shuts down the child gracefully on SIGINT, SIGTERM or when the master is gone,
+// SIGUSR1 reopens the log file. The signals are left to the Engine when there is one.
+func (c *Core) watchMaster() {
+	var sig chan os.Signal
+	if !c.engineSignals {
+		sig = make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGUSR1)
+	}
+
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		if runtime.GOOS == "windows" {
+			p, err := os.FindProcess(os.Getppid())
+			if err == nil {
+				_, _ = p.Wait()
+			}
+			return
+		}
+		// if it is equal to 1 (init process ID),
+		// it indicates that the master process has exited
+		for range time.NewTicker(time.Millisecond * 500).C {
+			if os.Getppid() == 1 {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case v := <-sig:
+			if v == syscall.SIGUSR1 {
+				if err := c.ReopenLog(); err != nil {
+					Log.Error("ReopenLog: %v\n", err)
+				}
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), c.Options.ShutdownTimeout)
+			_ = c.Shutdown(ctx)
+			cancel()
+			return
+		case <-gone:
+			ctx, cancel := context.WithTimeout(context.Background(), c.Options.ShutdownTimeout)
+			_ = c.Shutdown(ctx)
+			cancel()
+			os.Exit(1)
+		}
+	}
+}
+
+// supervisor keeps GOMAXPROCS children running in the prefork master.
+//
+// Crashed children are restarted with backoff, SIGINT, SIGTERM and SIGQUIT
+// shut down the children gracefully, SIGHUP restarts them one by one
+// so a new binary on disk is picked up without downtime,
+// SIGUSR1 reopens the log files of the master and the children.
+// With an Engine the signals run the actions of Engine.Signal instead.
+type supervisor struct {
+	core       *Core
+	mu         sync.Mutex
+	slots      []*preforkSlot
+	stopping   bool
+	restarting bool
+	kept       bool          // the children are waited for by keep
+	stop       chan struct{} // closed by shutdown
+	wg         sync.WaitGroup
+	args       []string // command line of the children
+}
+
+// preforkSlot one child position, the process is replaced on restarts
+type preforkSlot struct {
+	id      int
+	cmd     *exec.Cmd
+	status  PreforkChild
+	restart bool          // requested restart, skip the backoff
+	next    chan struct{} // closed when the next process is started
+}
+
+// run start the children and block until the supervisor is shut down
+func (s *supervisor) run() error {
+	max := runtime.GOMAXPROCS(0)
+	for i := 0; i < max; i++ {
+		slot := &preforkSlot{id: i, next: make(chan struct{})}
+		if err := s.start(slot); err != nil {
+			s.kill()
+			return fmt.Errorf("failed to start a child prefork process, error: %v", err)
+		}
+		s.mu.Lock()
+		s.slots = append(s.slots, slot)
+		s.mu.Unlock()
+	}
+	s.mu.Lock()
+	s.kept = true
+	for _, slot := range s.slots {
+		s.wg.Add(1)
+		go s.keep(slot)
+	}
+	s.mu.Unlock()
+
+	// a nil channel never receives, the Engine handles the signals
+	var sig chan os.Signal
+	if !s.core.engineSignals {
+		sig = make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP, syscall.SIGUSR1)
+		defer signal.Stop(sig)
+	}
+
+	for {
+		select {
+		case <-s.stop:
+			s.wg.Wait()
+			return nil
+		case v := <-sig:
+			switch v {
+			case syscall.SIGHUP:
+				s.core.Restart()
+				continue
+			case syscall.SIGUSR1:
+				if err := s.core.ReopenLog(); err != nil {
+					Log.Error("ReopenLog: %v\n", err)
+				}
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), s.core.Options.ShutdownTimeout)
+			_ = s.core.Shutdown(ctx)
+			cancel()
+		}
+	}
+}
+
+// start a new child process in the slot
+func (s *supervisor) start(slot *preforkSlot) error {
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		return fmt.Errorf("prefork: shutting down")
+	}
+
+	cmd := exec.Command(s.args[0], s.args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("%s=%s", envChildKey, envChildVal),
+		fmt.Sprintf("%s=%d", envChildIDKey, slot.id),
+	)
+	if err := cmd.Start(); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	if slot.cmd != nil {
+		slot.status.Restarts++
+	}
+	slot.cmd = cmd
+	slot.status.Pid = cmd.Process.Pid
+	slot.status.Started = time.Now()
+	slot.status.Running = true
+	close(slot.next)
+	slot.next = make(chan struct{})
+	status := slot.status
+	s.mu.Unlock()
+
+	s.notify(status)
+	return nil
+}
+
+// keep wait for the child of the slot and restart it until the supervisor stops
+func (s *supervisor) keep(slot *preforkSlot) {
+	defer s.wg.Done()
+	backoff := preforkMinBackoff
+	for {
+		err := slot.cmd.Wait()
+
+		s.mu.Lock()
+		slot.status.Running = false
+		slot.status.Err = err
+		stopping, restart := s.stopping, slot.restart
+		slot.restart = false
+		uptime := time.Since(slot.status.Started)
+		status := slot.status
+		s.mu.Unlock()
+
+		s.notify(status)
+
+		if stopping {
+			return
+		}
+
+		if restart || uptime > preforkStableTime {
+			backoff = preforkMinBackoff
+		}
+		if !restart {
+			Log.Warn("Prefork: child %d exited: %v, restart in %s\n", status.Pid, err, backoff)
+			select {
+			case <-time.After(backoff):
+			case <-s.stop:
+				return
+			}
+			if backoff *= 2; backoff > preforkMaxBackoff {
+				backoff = preforkMaxBackoff
+			}
+		}
+
+		for {
+			if err = s.start(slot); err == nil {
+				break
+			}
+			Log.Error("Prefork: restart child: %v\n", err)
+			select {
+			case <-time.After(backoff):
+			case <-s.stop:
+				return
+			}
+		}
+	}
+}
+
+// restart replace the children one by one
+func (s *supervisor) restart() {
+	s.mu.Lock()
+	if s.restarting {
+		s.mu.Unlock()
+		return
+	}
+	s.restarting = true
+	slots := s.slots
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.restarting = false
+		s.mu.Unlock()
+	}()
+
+	Log.Info("Prefork: rolling restart\n")
+	for _, slot := range slots {
+		s.mu.Lock()
+		if s.stopping {
+			s.mu.Unlock()
+			return
+		}
+		// a crashed child is restarted by keep
+		if !slot.status.Running {
+			s.mu.Unlock()
+			continue
+		}
+		slot.restart = true
+		proc, next := slot.cmd.Process, slot.next
+		s.mu.Unlock()
+
+		terminate(proc)
+		select {
+		case <-next:
+		case <-time.After(s.core.Options.ShutdownTimeout):
+			_ = proc.Kill()
+			// keep starts no process once the supervisor stops
+			select {
+			case <-next:
+			case <-s.stop:
+				return
+			}
+		case <-s.stop:
+			return
+		}
+		time.Sleep(preforkRollDelay)
+	}
+}
+
+// shutdown send SIGTERM to the children and wait for them to exit,
+// children still running when ctx is done are killed
+func (s *supervisor) shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.stopping {
+		s.stopping = true
+		close(s.stop)
+	}
+	for _, slot := range s.slots {
+		if slot.status.Running {
+			terminate(slot.cmd.Process)
+		}
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.kill()
+		return ctx.Err()
+	}
+}
+
+// kill the running children and wait for them to exit,
+// the children are reaped by keep once it runs, by kill before
+func (s *supervisor) kill() {
+	s.mu.Lock()
+	var killed []*exec.Cmd
+	for _, slot := range s.slots {
+		if slot.status.Running {
+			_ = slot.cmd.Process.Kill()
+			killed = append(killed, slot.cmd)
+		}
+	}
+	kept := s.kept
+	s.mu.Unlock()
+
+	if kept {
+		s.wg.Wait()
+		return
+	}
+	for _, cmd := range killed {
+		_ = cmd.Wait()
+	}
+}
+
+// signal send sig to the running children
+func (s *supervisor) signal(sig os.Signal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, slot := range s.slots {
+		if slot.status.Running {
+			_ = slot.cmd.Process.Signal(sig)
+		}
+	}
+}
+
+// status returns a copy of the children status
+func (s *supervisor) status() []PreforkChild {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	children := make([]PreforkChild, 0, len(s.slots))
+	for _, slot := range s.slots {
+		children = append(children, slot.status)
+	}
+	return children
+}
+
+// notify call Options.OnPrefork
+func (s *supervisor) notify(child PreforkChild) {
+	if s.core.Options.OnPrefork != nil {
+		s.core.Options.OnPrefork(child)
+	}
+}
+
+// terminate ask the process to shut down gracefully,
+// windows does not support SIGTERM so the process is killed
+func terminate(p *os.Process) {
+	if err := p.Signal(syscall.SIGTERM); err != nil {
+		_ = p.Kill()
+	}
+}
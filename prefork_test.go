@@ -0,0 +1,220 @@
+package cola
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const (
+	// envTestChild how the fake child of TestPreforkHelperProcess behaves:
+	// "serve" exits on SIGTERM, "ignore" ignores SIGTERM, "crash" exits at once
+	envTestChild = "COLA_TEST_CHILD"
+	// envTestReady directory where the fake child creates a file named
+	// after its pid once its signals are set up
+	envTestReady = "COLA_TEST_READY"
+)
+
+// TestPreforkHelperProcess is the child process of the prefork tests
+func TestPreforkHelperProcess(t *testing.T) {
+	if !isChild() {
+		return
+	}
+	sig := make(chan os.Signal, 1)
+	switch os.Getenv(envTestChild) {
+	case "crash":
+		os.Exit(1)
+	case "ignore":
+		signal.Ignore(syscall.SIGTERM)
+	default:
+		signal.Notify(sig, syscall.SIGTERM)
+	}
+	ready := filepath.Join(os.Getenv(envTestReady), strconv.Itoa(os.Getpid()))
+	if err := ioutil.WriteFile(ready, nil, 0600); err != nil {
+		os.Exit(3)
+	}
+	select {
+	case <-sig:
+		os.Exit(0)
+	case <-time.After(10 * time.Second):
+		os.Exit(2)
+	}
+}
+
+// startSupervisor runs a supervisor of n fake children behaving like mode
+func startSupervisor(t *testing.T, mode string, n int, timeout time.Duration) (*Core, <-chan error) {
+	dir, err := ioutil.TempDir("", "cola-prefork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(envTestChild, mode)
+	os.Setenv(envTestReady, dir)
+	prev := runtime.GOMAXPROCS(n)
+	t.Cleanup(func() {
+		runtime.GOMAXPROCS(prev)
+		os.Unsetenv(envTestChild)
+		os.Unsetenv(envTestReady)
+		os.RemoveAll(dir)
+	})
+
+	app := New(&Options{ShutdownTimeout: timeout})
+	app.engineSignals = true
+	app.supervisor = &supervisor{
+		core: app,
+		stop: make(chan struct{}),
+		args: []string{os.Args[0], "-test.run=^TestPreforkHelperProcess$"},
+	}
+	done := make(chan error, 1)
+	go func() { done <- app.supervisor.run() }()
+
+	if mode == "crash" {
+		return app, done
+	}
+	waitChildren(t, app, func(children []PreforkChild) bool {
+		if len(children) != n {
+			return false
+		}
+		for _, child := range children {
+			if _, err := os.Stat(filepath.Join(dir, strconv.Itoa(child.Pid))); !child.Running || err != nil {
+				return false
+			}
+		}
+		return true
+	})
+	return app, done
+}
+
+// waitChildren waits until ok returns true for the status of the children
+func waitChildren(t *testing.T, app *Core, ok func([]PreforkChild) bool) []PreforkChild {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		children := app.PreforkStatus()
+		if ok(children) {
+			return children
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("children = %+v", children)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// reaped reports whether the process is gone, a zombie still exists
+func reaped(pid int) bool {
+	return syscall.Kill(pid, 0) == syscall.ESRCH
+}
+
+func TestPreforkRestart(t *testing.T) {
+	defer func(prev time.Duration) { preforkRollDelay = prev }(preforkRollDelay)
+	preforkRollDelay = 10 * time.Millisecond
+	app, done := startSupervisor(t, "serve", 2, 2*time.Second)
+	hooked := false
+	app.OnShutdown(func() error { hooked = true; return nil })
+	before := app.PreforkStatus()
+
+	app.supervisor.restart()
+	after := waitChildren(t, app, func(children []PreforkChild) bool {
+		for _, child := range children {
+			if !child.Running || child.Restarts != 1 {
+				return false
+			}
+		}
+		return true
+	})
+	for i := range after {
+		if after[i].Pid == before[i].Pid {
+			t.Fatalf("child %d not replaced: pid %d", i, after[i].Pid)
+		}
+		if !reaped(before[i].Pid) {
+			t.Fatalf("child %d: pid %d not reaped", i, before[i].Pid)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := app.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() = %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("run() = %v", err)
+	}
+	for _, child := range app.PreforkStatus() {
+		if child.Running || !reaped(child.Pid) {
+			t.Fatalf("child %d still running", child.Pid)
+		}
+	}
+	// the hooks run in the children
+	if hooked {
+		t.Fatal("OnShutdown hook ran in the prefork master")
+	}
+}
+
+func TestPreforkShutdownKill(t *testing.T) {
+	app, done := startSupervisor(t, "ignore", 2, time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := app.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown() = %v, want context.DeadlineExceeded", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("run() = %v", err)
+	}
+	for _, child := range app.PreforkStatus() {
+		if child.Running || child.Err == nil || !reaped(child.Pid) {
+			t.Fatalf("child %+v not killed", child)
+		}
+	}
+}
+
+// TestPreforkRestartStopped shuts down while a rolling restart
+// waits for a killed child, keep starts no new process
+func TestPreforkRestartStopped(t *testing.T) {
+	app, done := startSupervisor(t, "ignore", 1, 100*time.Millisecond)
+	s := app.supervisor
+
+	restarted := make(chan struct{})
+	go func() {
+		s.restart()
+		close(restarted)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	// shutdown begins, the child is killed by restart after ShutdownTimeout
+	s.mu.Lock()
+	s.stopping = true
+	s.mu.Unlock()
+	waitChildren(t, app, func(children []PreforkChild) bool { return !children[0].Running })
+	s.mu.Lock()
+	close(s.stop)
+	s.mu.Unlock()
+
+	select {
+	case <-restarted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("restart() did not return after the supervisor stopped")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("run() = %v", err)
+	}
+}
+
+func TestPreforkCrashRestart(t *testing.T) {
+	app, done := startSupervisor(t, "crash", 1, time.Second)
+	waitChildren(t, app, func(children []PreforkChild) bool {
+		return len(children) == 1 && children[0].Restarts >= 2 && children[0].Err != nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = app.Shutdown(ctx)
+	if err := <-done; err != nil {
+		t.Fatalf("run() = %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package cola
 
 import (
+	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -49,9 +51,65 @@ type Route struct {
 	Params      []string
 	Path        string
 	Method      string
+	Name        string      // Name used for reverse url generation
 	routeParser routeParser // Parameter parser
 }
 
+// URL build the path of the route with the params.
+// params are the route parameters in order, or a Map by parameter name,
+// a missing optional parameter is left out.
+func (r *Route) URL(params ...interface{}) (string, error) {
+	// parse the raw path again, the parser of the route is lowercased
+	parser := parseRoute(r.Path)
+	if len(parser.segs) == 0 {
+		return r.Path, nil
+	}
+	var named Map
+	if len(params) == 1 {
+		named, _ = params[0].(Map)
+	}
+
+	var buf strings.Builder
+	i := 0
+	for _, seg := range parser.segs {
+		if !seg.IsParam {
+			buf.WriteString(seg.Const)
+			continue
+		}
+		var val interface{}
+		if named != nil {
+			val = named[seg.ParamName]
+		} else if i < len(params) {
+			val = params[i]
+			i++
+		}
+		value := ""
+		if val != nil {
+			value = fmt.Sprint(val)
+		}
+		if value == "" {
+			if !seg.IsOptional {
+				return "", fmt.Errorf("url: missing param %s in route %s", seg.ParamName, r.Path)
+			}
+			continue
+		}
+		if !seg.matchConstraints(value) {
+			return "", fmt.Errorf("url: param %s=%s does not satisfy the constraints of route %s", seg.ParamName, value, r.Path)
+		}
+		if !seg.IsGreedy {
+			value = url.PathEscape(value)
+		}
+		buf.WriteString(value)
+	}
+
+	// remove the slashes of missing optional params
+	uri := strings.Replace(buf.String(), "//", "/", -1)
+	if len(uri) > 1 {
+		uri = TrimRight(uri, slashDelimiter)
+	}
+	return uri, nil
+}
+
 func (r *Route) match(detectionPath, path string, params *[maxParams]string) (match bool) {
 	// root detectionPath check
 	if r.root && detectionPath == "/" {
@@ -100,12 +158,13 @@ type routeSegment struct {
 	// const information
 	Const string // constant part of the route
 	// parameter information
-	IsParam     bool   // Truth value that indicates whether it is a parameter or a constant part
-	ParamName   string // name of the parameter for access to it, for wildcards and plus parameters access iterators starting with 1 are added
-	ComparePart string // search part to find the end of the parameter
-	PartCount   int    // how often is the search part contained in the non-param segments? -> necessary for greedy search
-	IsGreedy    bool   // indicates whether the parameter is greedy or not, is used with wildcard and plus
-	IsOptional  bool   // indicates whether the parameter is optional or not
+	IsParam     bool          // Truth value that indicates whether it is a parameter or a constant part
+	ParamName   string        // name of the parameter for access to it, for wildcards and plus parameters access iterators starting with 1 are added
+	ComparePart string        // search part to find the end of the parameter
+	PartCount   int           // how often is the search part contained in the non-param segments? -> necessary for greedy search
+	IsGreedy    bool          // indicates whether the parameter is greedy or not, is used with wildcard and plus
+	IsOptional  bool          // indicates whether the parameter is optional or not
+	Constraints []*constraint // constraints the parameter value must satisfy, e.g. :id<int>
 	// common information
 	IsLast           bool // shows if the segment is the last one for the route
 	HasOptionalSlash bool // segment has the possibility of an optional slash
@@ -120,6 +179,12 @@ const (
 	optionalParam    byte = '?' // concludes a parameter by name and makes it optional
 	paramStarterChar byte = ':' // start character for a parameter with name
 	slashDelimiter   byte = '/' // separator for the route, unlike the other delimiters this character at the end can be optional
+
+	paramConstraintStart     byte = '<' // start of the parameter constraints, e.g. :id<int>
+	paramConstraintEnd       byte = '>' // end of the parameter constraints
+	paramConstraintSeparator byte = ';' // separator of multiple constraints, e.g. :name<alpha;maxLen(8)>
+	paramConstraintDataStart byte = '(' // start of the constraint data, e.g. minLen(3)
+	paramConstraintDataEnd   byte = ')' // end of the constraint data
 )
 
 // list of possible parameter and segment delimiter
@@ -131,7 +196,7 @@ var (
 	// list of chars of delimiters and the starting parameter name char
 	parameterDelimiterChars = append([]byte{paramStarterChar}, routeDelimiter...)
 	// list of chars to find the end of a parameter
-	parameterEndChars = append([]byte{optionalParam}, parameterDelimiterChars...)
+	parameterEndChars = append([]byte{optionalParam, paramConstraintStart}, parameterDelimiterChars...)
 )
 
 // parseRoute analyzes the route and divides it into segments for constant areas and parameters,
@@ -248,12 +313,26 @@ func (routeParser *routeParser) analyseParameterPart(pattern string) (string, *r
 	isWildCard := pattern[0] == wildcardParam
 	isPlusParam := pattern[0] == plusParam
 	parameterEndPosition := findNextCharsetPosition(pattern[1:], parameterEndChars)
+	nameEndPosition := -1
+	var constraints []*constraint
 
 	// handle wildcard end
 	if isWildCard || isPlusParam {
 		parameterEndPosition = 0
 	} else if parameterEndPosition == -1 {
 		parameterEndPosition = len(pattern) - 1
+	} else if pattern[parameterEndPosition+1] == paramConstraintStart {
+		// the constraints follow the parameter name, e.g. :id<int>?
+		nameEndPosition = parameterEndPosition
+		constraintEnd := findConstraintEnd(pattern[parameterEndPosition+1:])
+		if constraintEnd == -1 {
+			panic(fmt.Sprintf("parseRoute: missing %q in route %s", paramConstraintEnd, pattern))
+		}
+		constraints = parseConstraints(pattern[parameterEndPosition+2 : parameterEndPosition+1+constraintEnd])
+		parameterEndPosition += constraintEnd + 1
+		if len(pattern) > parameterEndPosition+1 && pattern[parameterEndPosition+1] == optionalParam {
+			parameterEndPosition++
+		}
 	} else if !isInCharset(pattern[parameterEndPosition+1], parameterDelimiterChars) {
 		parameterEndPosition = parameterEndPosition + 1
 	}
@@ -261,6 +340,9 @@ func (routeParser *routeParser) analyseParameterPart(pattern string) (string, *r
 	processedPart := pattern[0 : parameterEndPosition+1]
 
 	paramName := GetTrimmedParam(processedPart)
+	if nameEndPosition != -1 {
+		paramName = GetTrimmedParam(pattern[0 : nameEndPosition+1])
+	}
 	// add access iterator to wildcard and plus
 	if isWildCard {
 		routeParser.wildCardCount++
@@ -271,10 +353,11 @@ func (routeParser *routeParser) analyseParameterPart(pattern string) (string, *r
 	}
 
 	return processedPart, &routeSegment{
-		ParamName:  paramName,
-		IsParam:    true,
-		IsOptional: isWildCard || pattern[parameterEndPosition] == optionalParam,
-		IsGreedy:   isWildCard || isPlusParam,
+		ParamName:   paramName,
+		IsParam:     true,
+		IsOptional:  isWildCard || pattern[parameterEndPosition] == optionalParam,
+		IsGreedy:    isWildCard || isPlusParam,
+		Constraints: constraints,
 	}
 }
 
@@ -321,6 +404,10 @@ func (routeParser *routeParser) getMatch(detectionPath, path string, params *[ma
 			if !segment.IsOptional && i == 0 {
 				return false
 			}
+			// the value must satisfy the constraints of the parameter
+			if len(segment.Constraints) > 0 && i > 0 && !segment.matchConstraints(path[:i]) {
+				return false
+			}
 			// take over the params positions
 			params[paramsIterator] = path[:i]
 			paramsIterator++
@@ -0,0 +1,250 @@
+package cola
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// benchRoutes registers a large amount of reflected like routes below /api
+func benchRoutes() *Core {
+	c := New()
+	noop := func(*Ctx) {}
+	c.Use(noop)
+	c.Use("/api", noop)
+	for i := 0; i < 300; i++ {
+		n := strconv.Itoa(i)
+		c.Add(MethodGet, "/api/resource"+n, noop)
+		c.Add(MethodGet, "/api/resource"+n+"/:param", noop)
+		c.Add(MethodPost, "/api/resource"+n+"/:param?", noop)
+	}
+	c.Add(MethodGet, "/static/*", noop)
+	return c.buildTree()
+}
+
+// legacyTree is the former prefix bucket tree, routes are grouped by
+// the first three characters of the first constant segment
+func legacyTree(stack [][]*Route) []map[string][]*Route {
+	treeStack := make([]map[string][]*Route, len(Methods))
+	for m := range Methods {
+		treeStack[m] = make(map[string][]*Route)
+		for _, route := range stack[m] {
+			treePath := ""
+			if len(route.routeParser.segs) > 0 && len(route.routeParser.segs[0].Const) >= 3 {
+				treePath = route.routeParser.segs[0].Const[:3]
+			}
+			treeStack[m][treePath] = append(treeStack[m][treePath], route)
+		}
+	}
+	for m := range Methods {
+		for treePart := range treeStack[m] {
+			if treePart != "" {
+				treeStack[m][treePart] = uniqueRoutes(append(treeStack[m][treePart], treeStack[m][""]...))
+			}
+			sort.Slice(treeStack[m][treePart], func(i, j int) bool {
+				return treeStack[m][treePart][i].pos < treeStack[m][treePart][j].pos
+			})
+		}
+	}
+	return treeStack
+}
+
+func uniqueRoutes(stack []*Route) []*Route {
+	var unique []*Route
+	m := make(map[*Route]struct{})
+	for _, v := range stack {
+		if _, ok := m[v]; !ok {
+			m[v] = struct{}{}
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// matchRoute returns the first non use route which matches
+func matchRoute(tree []*Route, path string, values *[maxParams]string) *Route {
+	for _, route := range tree {
+		if !route.use && route.match(path, path, values) {
+			return route
+		}
+	}
+	return nil
+}
+
+var benchPaths = []string{
+	"/api/resource0",
+	"/api/resource150/42",
+	"/api/resource299/42",
+	"/static/css/app.css",
+	"/not/found",
+}
+
+func BenchmarkRouterRadix(b *testing.B) {
+	c := benchRoutes()
+	m := methodInt(MethodGet)
+	var values [maxParams]string
+	var tree []*Route
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, path := range benchPaths {
+			tree = c.trees()[m].find(path, tree[:0])
+			matchRoute(tree, path, &values)
+		}
+	}
+}
+
+func BenchmarkRouterBucket(b *testing.B) {
+	c := benchRoutes()
+	treeStack := legacyTree(c.stack)
+	m := methodInt(MethodGet)
+	var values [maxParams]string
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, path := range benchPaths {
+			treePath := ""
+			if len(path) >= 3 {
+				treePath = path[:3]
+			}
+			tree, ok := treeStack[m][treePath]
+			if !ok {
+				tree = treeStack[m][""]
+			}
+			matchRoute(tree, path, &values)
+		}
+	}
+}
+
+type urlHandler struct {
+	Handler
+}
+
+func (h *urlHandler) GetInfo(c *Ctx) {}
+
+func TestURL(t *testing.T) {
+	app := New()
+	noop := func(*Ctx) {}
+	app.Add(MethodGet, "/User/:id/Edit", noop).Name("user")
+	app.Add(MethodGet, "/p/:a?/x/:b?", noop).Name("optional")
+	app.Add(MethodGet, "/files/*", noop).Name("files")
+	app.Group("/api").Get("/post/:id", noop).Name("post")
+	app.Use(new(urlHandler))
+
+	for _, tt := range []struct {
+		name   string
+		params []interface{}
+		want   string
+	}{
+		{"user", []interface{}{5}, "/User/5/Edit"},
+		{"user", []interface{}{Map{"id": "a b"}}, "/User/a%20b/Edit"},
+		{"optional", nil, "/p/x"},
+		{"optional", []interface{}{"1"}, "/p/1/x"},
+		{"optional", []interface{}{"1", "2"}, "/p/1/x/2"},
+		{"files", []interface{}{"css/app.css"}, "/files/css/app.css"},
+		{"post", []interface{}{1}, "/api/post/1"},
+		{"cola.urlHandler.GetInfo", nil, "/info"},
+	} {
+		got, err := app.URL(tt.name, tt.params...)
+		if err != nil || got != tt.want {
+			t.Errorf("URL(%q, %v) = %q, %v, want %q", tt.name, tt.params, got, err, tt.want)
+		}
+	}
+	if _, err := app.URL("user"); err == nil {
+		t.Error("URL() without the required param returns no error")
+	}
+	if _, err := app.URL("missing"); err == nil {
+		t.Error("URL() of a missing route returns no error")
+	}
+}
+
+// TestServeWithoutCore serves through the embedded fasthttp.Server,
+// the route tree is built on the first request
+func TestServeWithoutCore(t *testing.T) {
+	app := New()
+	app.Add(MethodGet, "/hello", func(c *Ctx) { c.SendString("hello") })
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go app.Server.Serve(ln)
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != StatusOK || string(body) != "hello" {
+		t.Fatalf("GET /hello = %d %q", resp.StatusCode, body)
+	}
+}
+
+// TestAddRouteWhileServing adds routes while requests are served,
+// run with -race
+func TestAddRouteWhileServing(t *testing.T) {
+	app := New()
+	app.Add(MethodGet, "/a", func(c *Ctx) { c.SendString("a") })
+	tc := NewTestClient(app)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			app.Add(MethodGet, "/r"+strconv.Itoa(i), func(c *Ctx) { c.SendString("r") })
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if err := tc.Get("/a").Expect(StatusOK).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	for i := 0; i < 50; i++ {
+		if err := tc.Get("/r" + strconv.Itoa(i)).Expect(StatusOK).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	noop := func(c *Ctx) { c.SendString("ok") }
+	app := New()
+	app.Use(func(c *Ctx) { c.Next() })
+	app.Add(MethodGet, "/user/:id", noop)
+	app.Add(MethodPut, "/user/:id", noop)
+	app.Add(MethodPost, "/custom", noop)
+	app.Add(MethodOptions, "/custom", func(c *Ctx) { c.Status(StatusOK).SendString("custom") })
+	tc := NewTestClient(app)
+
+	for _, tt := range []struct {
+		method, path string
+		status       int
+		allow        string
+	}{
+		{MethodDelete, "/user/1", StatusMethodNotAllowed, "GET, PUT"},
+		{MethodOptions, "/user/1", StatusNoContent, "GET, PUT, OPTIONS"},
+		{MethodGet, "/custom", StatusMethodNotAllowed, "POST, OPTIONS"},
+		// a registered OPTIONS route takes precedence
+		{MethodOptions, "/custom", StatusOK, ""},
+		{MethodDelete, "/missing", StatusNotFound, ""},
+		{MethodOptions, "/missing", StatusNotFound, ""},
+	} {
+		if err := tc.Request(tt.method, tt.path).Expect(tt.status).ExpectHeader(HeaderAllow, tt.allow).Err(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	app = New(&Options{DisableMethodNotAllowed: true, DisableAutoOptions: true})
+	app.Add(MethodGet, "/user/:id", noop)
+	tc = NewTestClient(app)
+	for _, method := range []string{MethodDelete, MethodOptions} {
+		if err := tc.Request(method, "/user/1").Expect(StatusNotFound).ExpectHeader(HeaderAllow, "").Err(); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package cola
+
+import (
+	"github.com/xs23933/cola/session"
+)
+
+// Session returns the session of the request, loaded from the signed
+// session cookie on first call. Changes are saved after the handlers return.
+//
+//	sess := c.Session()
+//	sess.Set("uid", user.ID)
+//	sess.Flash("info", "saved")
+func (c *Ctx) Session() *session.Session {
+	if c.session == nil {
+		m := c.Core.sessionManager()
+		name := m.Config().CookieName
+		// copy the cookie, the stores may keep the id
+		sess, err := m.Start(string(c.Request.Header.Cookie(name)))
+		if err != nil {
+			Log.Error("Session: %v", err)
+		}
+		c.session = sess
+	}
+	return c.session
+}
+
+// flashes is bound to .flashes by Render, the messages are only
+// read and removed from the session by the flashes template helper
+type flashes struct {
+	c *Ctx
+}
+
+// templateFlashes the flashes template helper, it returns the messages of key,
+// all messages by key without key.
+//
+//	{{ range flashes .flashes "info" }}<p>{{ . }}</p>{{ end }}
+func templateFlashes(src interface{}, key ...string) interface{} {
+	f, ok := src.(*flashes)
+	if !ok {
+		return nil
+	}
+	if len(key) > 0 {
+		return f.c.Session().Flashes(key[0])
+	}
+	return f.c.Session().AllFlashes()
+}
+
+// hasSession reports whether the request has a session loaded or a session cookie,
+// it does not create the default session manager
+func (c *Ctx) hasSession() bool {
+	if c.session != nil {
+		return true
+	}
+	m := c.Core.Options.Session
+	if m == nil {
+		// no session cookie was set without a manager
+		if m, _ = c.Core.defaultSession.Load().(*session.Manager); m == nil {
+			return false
+		}
+	}
+	return len(c.Request.Header.Cookie(m.Config().CookieName)) > 0
+}
+
+// saveSession save the session and set or clear the session cookie
+func (c *Ctx) saveSession() {
+	sess := c.session
+	cfg := c.Core.sessionManager().Config()
+	value, err := sess.Save()
+	if err != nil {
+		Log.Error("Session: %v", err)
+		return
+	}
+	if sess.Destroyed() {
+		if len(c.Request.Header.Cookie(cfg.CookieName)) > 0 {
+			c.DelCookie(cfg.CookieName, cfg.CookiePath)
+		}
+		return
+	}
+	if value == "" {
+		return
+	}
+	c.Cookie(&Cookie{
+		Name:     cfg.CookieName,
+		Value:    value,
+		Path:     cfg.CookiePath,
+		Domain:   cfg.CookieDomain,
+		MaxAge:   int(cfg.TTL.Seconds()),
+		Secure:   cfg.CookieSecure,
+		HTTPOnly: true,
+		SameSite: cfg.CookieSameSite,
+	})
+}
+
+// sessionManager returns Options.Session, a memory store manager when not set
+func (c *Core) sessionManager() *session.Manager {
+	if c.Options.Session != nil {
+		return c.Options.Session
+	}
+	c.sessionOnce.Do(func() {
+		c.defaultSession.Store(session.New())
+	})
+	return c.defaultSession.Load().(*session.Manager)
+}
@@ -0,0 +1,152 @@
+package session
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+)
+
+// data saved in the store
+type data struct {
+	Values  map[string]interface{}
+	Flashes map[string][]interface{}
+	Expires time.Time
+}
+
+// Session data of a client
+type Session struct {
+	m     *Manager
+	id    string
+	data  data
+	oldID string // id replaced by Regenerate
+
+	fresh     bool
+	changed   bool
+	destroyed bool
+}
+
+// ID returns the session id
+func (s *Session) ID() string {
+	return s.id
+}
+
+// IsNew reports whether the session was created by this request
+func (s *Session) IsNew() bool {
+	return s.fresh
+}
+
+// Get returns the value of key
+func (s *Session) Get(key string) interface{} {
+	return s.data.Values[key]
+}
+
+// Set the value of key
+func (s *Session) Set(key string, value interface{}) {
+	s.data.Values[key] = value
+	s.changed = true
+}
+
+// Delete the value of key
+func (s *Session) Delete(key string) {
+	if _, ok := s.data.Values[key]; ok {
+		delete(s.data.Values, key)
+		s.changed = true
+	}
+}
+
+// Keys returns the keys of the session values
+func (s *Session) Keys() []string {
+	keys := make([]string, 0, len(s.data.Values))
+	for k := range s.data.Values {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Flash add a message read once by Flashes, usually in the next request
+func (s *Session) Flash(key string, value interface{}) {
+	s.data.Flashes[key] = append(s.data.Flashes[key], value)
+	s.changed = true
+}
+
+// Flashes returns and removes the messages of key
+func (s *Session) Flashes(key string) []interface{} {
+	values, ok := s.data.Flashes[key]
+	if ok {
+		delete(s.data.Flashes, key)
+		s.changed = true
+	}
+	return values
+}
+
+// AllFlashes returns and removes all messages
+func (s *Session) AllFlashes() map[string][]interface{} {
+	flashes := s.data.Flashes
+	if len(flashes) > 0 {
+		s.data.Flashes = make(map[string][]interface{})
+		s.changed = true
+	}
+	return flashes
+}
+
+// Regenerate give the session a new id and keeps the values,
+// call it after login to prevent session fixation
+func (s *Session) Regenerate() {
+	if s.oldID == "" && !s.fresh {
+		s.oldID = s.id
+	}
+	s.id = newID()
+	s.changed = true
+}
+
+// Destroy removes the session and its values
+func (s *Session) Destroy() {
+	s.data.Values = make(map[string]interface{})
+	s.data.Flashes = make(map[string][]interface{})
+	s.destroyed = true
+}
+
+// Destroyed reports whether Destroy was called
+func (s *Session) Destroyed() bool {
+	return s.destroyed
+}
+
+// Save the session to the store when it changed or half of the TTL passed,
+// it returns the signed cookie value to send, "" when the cookie is unchanged.
+// A destroyed session is deleted from the store.
+func (s *Session) Save() (string, error) {
+	store := s.m.config.Store
+	if s.oldID != "" {
+		if err := store.Delete(s.oldID); err != nil {
+			return "", err
+		}
+		s.oldID = ""
+	}
+	if s.destroyed {
+		if s.fresh {
+			return "", nil
+		}
+		return "", store.Delete(s.id)
+	}
+
+	ttl := s.m.config.TTL
+	if !s.changed && time.Until(s.data.Expires) > ttl/2 {
+		return "", nil
+	}
+	// a new session is only saved when something was set
+	if s.fresh && len(s.data.Values) == 0 && len(s.data.Flashes) == 0 {
+		return "", nil
+	}
+
+	s.data.Expires = time.Now().Add(ttl)
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(&s.data); err != nil {
+		return "", err
+	}
+	if err := store.Set(s.id, buf.Bytes(), ttl); err != nil {
+		return "", err
+	}
+	s.changed = false
+	s.fresh = false
+	return s.m.sign(s.id), nil
+}
@@ -0,0 +1,210 @@
+// Package session keeps data of a client between requests.
+//
+// The session id is sent in a signed cookie and the data is saved
+// in a Store, encoded with encoding/gob. Custom types stored in
+// a session must be registered with Register.
+package session
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store saves the encoded session data
+type Store interface {
+	// Get returns the data of id, nil when the session is missing or expired
+	Get(id string) ([]byte, error)
+	// Set saves the data of id for ttl
+	Set(id string, data []byte, ttl time.Duration) error
+	// Delete removes the session id
+	Delete(id string) error
+	// GC removes the expired sessions
+	GC() error
+}
+
+// Config session config
+type Config struct {
+	// Store of the session data.
+	// Optional. Default value NewMemoryStore().
+	Store Store
+
+	// Secret used to sign the session cookie,
+	// all processes of an app must use the same secret.
+	// Optional. Default value a random key, sessions are lost on restart.
+	Secret string
+
+	// Name of the session cookie.
+	// Optional. Default value "cola_session".
+	CookieName string
+
+	// Cookie attributes.
+	// Optional. Default value Path "/", SameSite "Lax".
+	CookiePath     string
+	CookieDomain   string
+	CookieSecure   bool
+	CookieSameSite string
+
+	// Time a session is kept after its last save.
+	// Optional. Default value 24 * time.Hour.
+	TTL time.Duration
+
+	// Interval of the Store GC.
+	// Use a negative time.Duration to disable it.
+	//
+	// Optional. Default value 10 * time.Minute.
+	GCInterval time.Duration
+}
+
+// Manager loads and saves the sessions
+type Manager struct {
+	config Config
+	secret []byte
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// New create a session manager and start the GC of the store
+func New(config ...Config) *Manager {
+	cfg := Config{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = "cola_session"
+	}
+	if cfg.CookiePath == "" {
+		cfg.CookiePath = "/"
+	}
+	if cfg.CookieSameSite == "" {
+		cfg.CookieSameSite = "Lax"
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+	if cfg.GCInterval == 0 {
+		cfg.GCInterval = 10 * time.Minute
+	}
+
+	m := &Manager{
+		config: cfg,
+		secret: []byte(cfg.Secret),
+		stop:   make(chan struct{}),
+	}
+	if len(m.secret) == 0 {
+		m.secret = make([]byte, 32)
+		_, _ = rand.Read(m.secret)
+	}
+	if cfg.GCInterval > 0 {
+		go m.gc()
+	}
+	return m
+}
+
+// Config returns the config of the manager
+func (m *Manager) Config() Config {
+	return m.config
+}
+
+// Close stop the GC of the store
+func (m *Manager) Close() {
+	m.once.Do(func() {
+		close(m.stop)
+	})
+}
+
+// Start returns the session of the signed cookie value,
+// a new session when the value is empty, invalid or expired.
+// On a store error a new session is returned with the error.
+func (m *Manager) Start(cookie string) (*Session, error) {
+	if id, ok := m.verify(cookie); ok {
+		raw, err := m.config.Store.Get(id)
+		if err != nil {
+			return m.create(), err
+		}
+		if raw != nil {
+			s := &Session{m: m, id: id}
+			if err = gob.NewDecoder(bytes.NewReader(raw)).Decode(&s.data); err != nil {
+				return m.create(), err
+			}
+			return s, nil
+		}
+	}
+	return m.create(), nil
+}
+
+func (m *Manager) create() *Session {
+	return &Session{
+		m:     m,
+		id:    newID(),
+		fresh: true,
+		data: data{
+			Values:  make(map[string]interface{}),
+			Flashes: make(map[string][]interface{}),
+		},
+	}
+}
+
+// sign returns the cookie value of id
+func (m *Manager) sign(id string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(id))
+	return id + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify returns the id of a signed cookie value
+func (m *Manager) verify(cookie string) (string, bool) {
+	i := strings.IndexByte(cookie, '.')
+	if i <= 0 {
+		return "", false
+	}
+	id := cookie[:i]
+	if !hmac.Equal([]byte(m.sign(id)), []byte(cookie)) {
+		return "", false
+	}
+	return id, true
+}
+
+func (m *Manager) gc() {
+	ticker := time.NewTicker(m.config.GCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = m.config.Store.GC()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// Register records a type stored in sessions, see gob.Register
+func Register(value interface{}) {
+	gob.Register(value)
+}
+
+// newID returns a random session id
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validID reports whether id looks like an id made by newID
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
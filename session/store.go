@@ -0,0 +1,241 @@
+package session
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidID is returned by the stores for a malformed session id
+var ErrInvalidID = errors.New("session: invalid id")
+
+// MemoryStore keeps the sessions in memory,
+// the sessions are lost on restart and not shared between prefork children
+type MemoryStore struct {
+	mu       sync.RWMutex
+	sessions map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+// NewMemoryStore create a memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]memoryEntry),
+	}
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(id string) ([]byte, error) {
+	s.mu.RLock()
+	e, ok := s.sessions[id]
+	s.mu.RUnlock()
+	if !ok || time.Now().After(e.expires) {
+		return nil, nil
+	}
+	return e.data, nil
+}
+
+// Set implements Store
+func (s *MemoryStore) Set(id string, data []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	s.sessions[id] = memoryEntry{data, time.Now().Add(ttl)}
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete implements Store
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// GC implements Store
+func (s *MemoryStore) GC() error {
+	now := time.Now()
+	s.mu.Lock()
+	for id, e := range s.sessions {
+		if now.After(e.expires) {
+			delete(s.sessions, id)
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// FileStore keeps every session in a file of dir,
+// the file starts with the expiry time followed by the data
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore create a file store in dir
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(id string) (string, error) {
+	if !validID(id) {
+		return "", ErrInvalidID
+	}
+	return filepath.Join(s.dir, id), nil
+}
+
+// Get implements Store
+func (s *FileStore) Get(id string) ([]byte, error) {
+	p, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < 8 || time.Now().UnixNano() > int64(binary.BigEndian.Uint64(raw)) {
+		return nil, nil
+	}
+	return raw[8:], nil
+}
+
+// Set implements Store
+func (s *FileStore) Set(id string, data []byte, ttl time.Duration) error {
+	p, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	raw := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint64(raw, uint64(time.Now().Add(ttl).UnixNano()))
+	raw = append(raw, data...)
+
+	// write a temporary file and rename it, readers never see a partial file
+	fp, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err = fp.Write(raw); err != nil {
+		fp.Close()
+		os.Remove(fp.Name())
+		return err
+	}
+	if err = fp.Close(); err != nil {
+		os.Remove(fp.Name())
+		return err
+	}
+	if err = os.Rename(fp.Name(), p); err != nil {
+		os.Remove(fp.Name())
+		return err
+	}
+	return nil
+}
+
+// Delete implements Store
+func (s *FileStore) Delete(id string) error {
+	p, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(p); os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// GC implements Store
+func (s *FileStore) GC() error {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UnixNano()
+	for _, f := range files {
+		if f.IsDir() || !validID(f.Name()) {
+			continue
+		}
+		p := filepath.Join(s.dir, f.Name())
+		fp, err := os.Open(p)
+		if err != nil {
+			continue
+		}
+		head := make([]byte, 8)
+		_, err = fp.Read(head)
+		fp.Close()
+		if err != nil || now > int64(binary.BigEndian.Uint64(head)) {
+			_ = os.Remove(p)
+		}
+	}
+	return nil
+}
+
+// GormStore keeps the sessions in a database table
+type GormStore struct {
+	db    *gorm.DB
+	table string
+}
+
+// gormSession row of the sessions table
+type gormSession struct {
+	ID        string    `gorm:"primaryKey;size:32"`
+	Data      []byte    `gorm:"type:blob"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// NewGormStore create a database store, the table is migrated.
+// table defaults to "sessions"
+//
+//	store, err := session.NewGormStore(cola.Conn())
+func NewGormStore(db *gorm.DB, table ...string) (*GormStore, error) {
+	s := &GormStore{db: db, table: "sessions"}
+	if len(table) > 0 && table[0] != "" {
+		s.table = table[0]
+	}
+	if err := db.Table(s.table).AutoMigrate(&gormSession{}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get implements Store
+func (s *GormStore) Get(id string) ([]byte, error) {
+	var row gormSession
+	err := s.db.Table(s.table).Where("id = ? AND expires_at > ?", id, time.Now()).Take(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return row.Data, nil
+}
+
+// Set implements Store
+func (s *GormStore) Set(id string, data []byte, ttl time.Duration) error {
+	row := gormSession{ID: id, Data: data, ExpiresAt: time.Now().Add(ttl)}
+	return s.db.Table(s.table).Save(&row).Error
+}
+
+// Delete implements Store
+func (s *GormStore) Delete(id string) error {
+	return s.db.Table(s.table).Where("id = ?", id).Delete(&gormSession{}).Error
+}
+
+// GC implements Store
+func (s *GormStore) GC() error {
+	return s.db.Table(s.table).Where("expires_at <= ?", time.Now()).Delete(&gormSession{}).Error
+}
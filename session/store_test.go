@@ -0,0 +1,44 @@
+package session
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileStoreConcurrentSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cola-sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := newID()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := store.Set(id, []byte("data"+strconv.Itoa(i)), time.Minute); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	data, err := store.Get(id)
+	if err != nil || len(data) == 0 {
+		t.Fatalf("Get() = %q, %v", data, err)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 || files[0].Name() != id {
+		t.Fatalf("dir has %d files, want only the session file", len(files))
+	}
+}
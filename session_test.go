@@ -0,0 +1,123 @@
+package cola
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	app := New()
+	app.Add(MethodGet, "/set", func(c *Ctx) {
+		c.Session().Set("n", 3)
+		c.Session().Flash("info", "hi")
+	})
+	app.Add(MethodGet, "/get", func(c *Ctx) {
+		c.SendString(fmt.Sprint(c.Session().Get("n"), c.Session().Flashes("info")))
+	})
+	app.Add(MethodGet, "/id", func(c *Ctx) { c.SendString(c.Session().ID()) })
+	app.Add(MethodGet, "/regenerate", func(c *Ctx) {
+		c.Session().Regenerate()
+		c.SendString(c.Session().ID())
+	})
+	app.Add(MethodGet, "/destroy", func(c *Ctx) { c.Session().Destroy() })
+	app.Add(MethodGet, "/none", func(c *Ctx) { c.SendString("none") })
+	tc := NewTestClient(app)
+
+	resp, err := tc.Get("/none").Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := resp.Header.Get(HeaderSetCookie); v != "" {
+		t.Fatalf("unused session sets cookie %q", v)
+	}
+	resp, err = tc.Get("/set").Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := resp.Header.Get(HeaderSetCookie); !strings.HasPrefix(v, "cola_session=") || !strings.Contains(v, "HttpOnly") {
+		t.Fatalf("Set-Cookie = %q", v)
+	}
+	for _, want := range []string{"3 [hi]", "3 []"} {
+		if got, _ := tc.Get("/get").String(); got != want {
+			t.Fatalf("GET /get = %q, want %q", got, want)
+		}
+	}
+
+	id, _ := tc.Get("/id").String()
+	regenerated, _ := tc.Get("/regenerate").String()
+	if regenerated == "" || regenerated == id {
+		t.Fatalf("Regenerate() id = %q, was %q", regenerated, id)
+	}
+	if got, _ := tc.Get("/get").String(); got != "3 []" {
+		t.Fatalf("GET /get after Regenerate = %q, want 3 []", got)
+	}
+
+	resp, err = tc.Get("/destroy").Response()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := resp.Header.Get(HeaderSetCookie); !strings.HasPrefix(v, "cola_session=;") {
+		t.Fatalf("Destroy() Set-Cookie = %q", v)
+	}
+	if got, _ := tc.Get("/get").String(); got != "<nil> []" {
+		t.Fatalf("GET /get after Destroy = %q, want <nil> []", got)
+	}
+	if got, _ := NewTestClient(app).Get("/get").Cookie("cola_session", "abc.def").String(); got != "<nil> []" {
+		t.Fatalf("GET /get with a bad cookie = %q, want <nil> []", got)
+	}
+}
+
+func TestRenderFlashesLazy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cola-views")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	views := map[string]string{
+		"plain.html": `plain`,
+		"show.html":  `{{ range flashes .flashes "info" }}{{ . }}{{ end }}`,
+	}
+	for name, src := range views {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app := New(&Options{Views: NewView(dir, ".html")})
+	app.Add(MethodPost, "/flash", func(c *Ctx) {
+		c.Session().Flash("info", "saved")
+	})
+	app.Add(MethodGet, "/:view", func(c *Ctx) {
+		_ = c.Render(c.Params("view"))
+	})
+	tc := NewTestClient(app)
+
+	// rendering without a session does not create the default manager
+	if err = tc.Get("/plain").Expect(StatusOK).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if app.defaultSession.Load() != nil || app.Options.Session != nil {
+		t.Fatal("Render() created the session manager")
+	}
+	if err = tc.Post("/flash").Expect(StatusOK).Err(); err != nil {
+		t.Fatal(err)
+	}
+	// a view which does not read the flashes keeps them
+	for _, want := range []struct{ view, body string }{
+		{"plain", "plain"},
+		{"show", "saved"},
+		{"show", ""},
+	} {
+		got, err := tc.Get("/" + want.view).Expect(StatusOK).String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want.body {
+			t.Fatalf("GET /%s = %q, want %q", want.view, got, want.body)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package cola
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSSEClosed is returned when writing to a closed stream
+	ErrSSEClosed = errors.New("sse: stream closed")
+	// ErrSSEField is returned for an event name or id with a line break
+	ErrSSEField = errors.New("sse: event name and id must not contain line breaks")
+)
+
+// SSEStream writes Server-Sent Events to the client,
+// its methods are safe to call from several goroutines
+type SSEStream struct {
+	mu          sync.Mutex
+	w           *bufio.Writer
+	lastEventID string
+	done        chan struct{}
+	doneOnce    sync.Once
+}
+
+// SSE stream Server-Sent Events, fn runs after the handler returned
+// so the Ctx must not be used inside fn.
+// A heartbeat comment is sent every heartbeat to keep the connection
+// open and detect disconnected clients, default 15s, 0 disables it.
+//
+//	app.Add("GET", "/events", func(c *cola.Ctx) error {
+//		return c.SSE(func(s *cola.SSEStream) error {
+//			for {
+//				select {
+//				case <-s.Done():
+//					return nil
+//				case msg := <-messages:
+//					if err := s.Event("message", "", msg); err != nil {
+//						return err
+//					}
+//				}
+//			}
+//		})
+//	})
+func (c *Ctx) SSE(fn func(stream *SSEStream) error, heartbeat ...time.Duration) error {
+	interval := 15 * time.Second
+	if len(heartbeat) > 0 {
+		interval = heartbeat[0]
+	}
+
+	c.Response.Header.SetContentType(MIMETextEventStream)
+	c.Set(HeaderCacheControl, "no-cache")
+	c.Set(HeaderConnection, "keep-alive")
+	c.Set(HeaderXAccelBuffering, "no")
+
+	// the ctx is released before the stream is written
+	lastEventID := CopyString(c.Get(HeaderLastEventID))
+	c.Response.SetBodyStreamWriter(func(w *bufio.Writer) {
+		s := &SSEStream{
+			w:           w,
+			lastEventID: lastEventID,
+			done:        make(chan struct{}),
+		}
+		// w is reused once the writer returns, wait for the heartbeat
+		// and refuse the writes of goroutines started by fn
+		var wg sync.WaitGroup
+		defer func() {
+			s.mu.Lock()
+			s.close()
+			s.mu.Unlock()
+			wg.Wait()
+		}()
+
+		if interval > 0 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.heartbeat(interval)
+			}()
+		}
+
+		// send the headers at once
+		if err := s.flush(); err != nil {
+			return
+		}
+		if err := fn(s); err != nil {
+			Log.Error("SSE: %v\n", err)
+		}
+	})
+	return nil
+}
+
+// LastEventID returns the Last-Event-ID header sent by a reconnecting client
+func (s *SSEStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done returns a channel closed when the client is gone or the stream ended
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Event send an event, name and id are optional and must be single lines,
+// string and []byte data are sent as is, other data is encoded as json
+func (s *SSEStream) Event(name, id string, data interface{}) error {
+	if strings.ContainsAny(name, "\r\n") || strings.ContainsAny(id, "\r\n") {
+		return ErrSSEField
+	}
+	var msg string
+	switch d := data.(type) {
+	case string:
+		msg = d
+	case []byte:
+		msg = string(d)
+	default:
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		msg = BytesToString(raw)
+	}
+
+	var b strings.Builder
+	if id != "" {
+		b.WriteString("id: " + id + "\n")
+	}
+	if name != "" {
+		b.WriteString("event: " + name + "\n")
+	}
+	for _, line := range sseLines(msg) {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Data send an unnamed event
+func (s *SSEStream) Data(data interface{}) error {
+	return s.Event("", "", data)
+}
+
+// Comment send a comment, ignored by the client,
+// every line of text is sent as a comment line
+func (s *SSEStream) Comment(text string) error {
+	var b strings.Builder
+	for _, line := range sseLines(text) {
+		b.WriteString(": " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Retry set the reconnection time of the client
+func (s *SSEStream) Retry(d time.Duration) error {
+	return s.write("retry: " + strconv.FormatInt(d.Milliseconds(), 10) + "\n\n")
+}
+
+func (s *SSEStream) write(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		return ErrSSEClosed
+	default:
+	}
+	if _, err := s.w.WriteString(msg); err != nil {
+		s.close()
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		s.close()
+		return err
+	}
+	return nil
+}
+
+func (s *SSEStream) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.w.Flush(); err != nil {
+		s.close()
+		return err
+	}
+	return nil
+}
+
+func (s *SSEStream) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if s.Comment("ping") != nil {
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// sseLines splits text at the line breaks of the event stream: "\r\n", "\r" and "\n"
+func sseLines(text string) []string {
+	return strings.Split(sseNewline.Replace(text), "\n")
+}
+
+var sseNewline = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// close the done channel, the caller holds s.mu
+func (s *SSEStream) close() {
+	s.doneOnce.Do(func() {
+		close(s.done)
+	})
+}
@@ -0,0 +1,71 @@
+package cola
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSE(t *testing.T) {
+	app := New()
+	app.Add(MethodGet, "/events", func(c *Ctx) error {
+		return c.SSE(func(s *SSEStream) error {
+			if err := s.Event("update", "1", Map{"n": 1}); err != nil {
+				return err
+			}
+			if err := s.Event("up\ndate", "", "x"); err != ErrSSEField {
+				t.Errorf("Event() name with a newline = %v, want ErrSSEField", err)
+			}
+			if err := s.Event("", "2\r", "x"); err != ErrSSEField {
+				t.Errorf("Event() id with a newline = %v, want ErrSSEField", err)
+			}
+			if err := s.Data("a\nb\revent: x"); err != nil {
+				return err
+			}
+			// every line stays a comment
+			if err := s.Comment("c\r\ndata: x\ny"); err != nil {
+				return err
+			}
+			// heartbeats are sent while fn runs
+			time.Sleep(30 * time.Millisecond)
+			return nil
+		}, 5*time.Millisecond)
+	})
+
+	body, err := NewTestClient(app).Get("/events").
+		Expect(StatusOK).ExpectHeader(HeaderContentType, MIMETextEventStream).String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "id: 1\nevent: update\ndata: {\"n\":1}\n\ndata: a\ndata: b\ndata: event: x\n\n: c\n: data: x\n: y\n\n"
+	if !strings.HasPrefix(body, want) {
+		t.Fatalf("body = %q, want prefix %q", body, want)
+	}
+	if !strings.Contains(body, ": ping\n\n") {
+		t.Fatalf("body = %q, want a heartbeat", body)
+	}
+}
+
+func TestSSEClosedAfterReturn(t *testing.T) {
+	app := New()
+	streams := make(chan *SSEStream, 1)
+	app.Add(MethodGet, "/events", func(c *Ctx) error {
+		return c.SSE(func(s *SSEStream) error {
+			streams <- s
+			return nil
+		}, time.Millisecond)
+	})
+
+	if err := NewTestClient(app).Get("/events").Expect(StatusOK).Err(); err != nil {
+		t.Fatal(err)
+	}
+	s := <-streams
+	select {
+	case <-s.Done():
+	default:
+		t.Fatal("Done() not closed after fn returned")
+	}
+	if err := s.Data("late"); err != ErrSSEClosed {
+		t.Fatalf("Data() after close = %v, want ErrSSEClosed", err)
+	}
+}
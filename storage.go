@@ -0,0 +1,148 @@
+package cola
+
+import (
+	"sync"
+	"time"
+)
+
+// Storage is a key value store used by the middleware, like Limiter.
+// Implement it with a shared database such as redis
+// to share the state between prefork children and servers.
+type Storage interface {
+	// Get returns the value of key, nil when the key is missing or expired
+	Get(key string) ([]byte, error)
+	// Set the value of key, a exp of 0 never expires
+	Set(key string, val []byte, exp time.Duration) error
+	// Delete the value of key
+	Delete(key string) error
+	// Reset removes all keys
+	Reset() error
+	// Close the storage
+	Close() error
+}
+
+// StorageUpdater is implemented by a Storage which updates a key atomically,
+// the Limiter needs it to count the requests of several processes sharing the storage.
+type StorageUpdater interface {
+	// Update calls fn with the value of key, nil when the key is missing or expired,
+	// and sets the value returned by fn for exp. Other updates of key wait for it.
+	Update(key string, fn func(val []byte) ([]byte, time.Duration)) error
+}
+
+// MemoryStorage keeps the values in the memory of the process,
+// prefork children each have their own values.
+type MemoryStorage struct {
+	mu   sync.RWMutex
+	data map[string]memoryItem
+	stop chan struct{}
+	once sync.Once
+}
+
+type memoryItem struct {
+	val     []byte
+	expires int64 // unix nano, 0 never expires
+}
+
+// NewMemoryStorage create a memory storage, the expired keys are removed
+// every gcInterval.
+//
+// gcInterval default 10 * time.Second
+func NewMemoryStorage(gcInterval ...time.Duration) *MemoryStorage {
+	s := &MemoryStorage{
+		data: make(map[string]memoryItem),
+		stop: make(chan struct{}),
+	}
+	interval := 10 * time.Second
+	if len(gcInterval) > 0 && gcInterval[0] > 0 {
+		interval = gcInterval[0]
+	}
+	go s.gc(interval)
+	return s
+}
+
+// Get implements Storage
+func (s *MemoryStorage) Get(key string) ([]byte, error) {
+	s.mu.RLock()
+	item, ok := s.data[key]
+	s.mu.RUnlock()
+	if !ok || item.expires != 0 && item.expires <= time.Now().UnixNano() {
+		return nil, nil
+	}
+	return item.val, nil
+}
+
+// Set implements Storage
+func (s *MemoryStorage) Set(key string, val []byte, exp time.Duration) error {
+	var expires int64
+	if exp > 0 {
+		expires = time.Now().Add(exp).UnixNano()
+	}
+	// keep a copy, val may be reused by the caller
+	item := memoryItem{append([]byte(nil), val...), expires}
+	s.mu.Lock()
+	s.data[key] = item
+	s.mu.Unlock()
+	return nil
+}
+
+// Update implements StorageUpdater
+func (s *MemoryStorage) Update(key string, fn func(val []byte) ([]byte, time.Duration)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var val []byte
+	if item, ok := s.data[key]; ok && (item.expires == 0 || item.expires > now.UnixNano()) {
+		val = item.val
+	}
+	val, exp := fn(val)
+	var expires int64
+	if exp > 0 {
+		expires = now.Add(exp).UnixNano()
+	}
+	s.data[key] = memoryItem{append([]byte(nil), val...), expires}
+	return nil
+}
+
+// Delete implements Storage
+func (s *MemoryStorage) Delete(key string) error {
+	s.mu.Lock()
+	delete(s.data, key)
+	s.mu.Unlock()
+	return nil
+}
+
+// Reset implements Storage
+func (s *MemoryStorage) Reset() error {
+	s.mu.Lock()
+	s.data = make(map[string]memoryItem)
+	s.mu.Unlock()
+	return nil
+}
+
+// Close implements Storage, it stops the gc
+func (s *MemoryStorage) Close() error {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	return nil
+}
+
+func (s *MemoryStorage) gc(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now().UnixNano()
+			s.mu.Lock()
+			for k, item := range s.data {
+				if item.expires != 0 && item.expires <= now {
+					delete(s.data, k)
+				}
+			}
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package cola
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+// Test send the request to the app through an in-memory connection
+// and returns the response, no TCP port is opened.
+//
+// timeout default 1s, a timeout <= 0 waits for the response forever
+//
+//	req := httptest.NewRequest("GET", "/user/1", nil)
+//	res, err := app.Test(req)
+func (c *Core) Test(req *http.Request, timeout ...time.Duration) (*http.Response, error) {
+	to := time.Second
+	if len(timeout) > 0 {
+		to = timeout[0]
+	}
+
+	// Routes may be added between tests, rebuild the tree when needed
+	c.ensureTree()
+
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		_ = c.Server.ServeConn(conn)
+	}()
+
+	conn, err := ln.Dial()
+	if err != nil {
+		return nil, err
+	}
+
+	// the server closes the connection after the response
+	req.Close = true
+	if err = req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	type result struct {
+		res *http.Response
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		res, err := http.ReadResponse(bufio.NewReader(conn), req)
+		ch <- result{res, err}
+	}()
+
+	var r result
+	if to > 0 {
+		select {
+		case r = <-ch:
+		case <-time.After(to):
+			conn.Close()
+			return nil, fmt.Errorf("test: timeout after %s", to)
+		}
+	} else {
+		r = <-ch
+	}
+	if r.err != nil {
+		conn.Close()
+	}
+	return r.res, r.err
+}
+
+// TestClient send requests to the app with Core.Test and keeps the cookies between requests.
+//
+//	tc := cola.NewTestClient(app)
+//	var out cola.Map
+//	err := tc.Get("/user/1").Header("X-Token", "t").Expect(200).JSON(&out)
+type TestClient struct {
+	core    *Core
+	jar     http.CookieJar
+	Timeout time.Duration // Default: 1s
+}
+
+// NewTestClient create a test client of the app
+func NewTestClient(core *Core) *TestClient {
+	jar, _ := cookiejar.New(nil)
+	return &TestClient{
+		core:    core,
+		jar:     jar,
+		Timeout: time.Second,
+	}
+}
+
+// Get create a GET request
+func (tc *TestClient) Get(path string) *TestRequest {
+	return tc.Request(MethodGet, path)
+}
+
+// Post create a POST request
+func (tc *TestClient) Post(path string) *TestRequest {
+	return tc.Request(MethodPost, path)
+}
+
+// Put create a PUT request
+func (tc *TestClient) Put(path string) *TestRequest {
+	return tc.Request(MethodPut, path)
+}
+
+// Delete create a DELETE request
+func (tc *TestClient) Delete(path string) *TestRequest {
+	return tc.Request(MethodDelete, path)
+}
+
+// Patch create a PATCH request
+func (tc *TestClient) Patch(path string) *TestRequest {
+	return tc.Request(MethodPatch, path)
+}
+
+// Request create a request of method and path, the request is sent
+// by the first call of Expect, ExpectHeader, Response, Bytes, String or JSON
+func (tc *TestClient) Request(method, path string) *TestRequest {
+	return &TestRequest{
+		client: tc,
+		method: method,
+		path:   path,
+		header: make(http.Header),
+		query:  make(url.Values),
+		form:   make(url.Values),
+	}
+}
+
+// TestRequest a request of TestClient, the errors are kept and
+// returned by Err and the methods reading the response
+type TestRequest struct {
+	client  *TestClient
+	method  string
+	path    string
+	header  http.Header
+	query   url.Values
+	cookies []*http.Cookie
+	form    url.Values
+	files   []testFile
+	body    io.Reader
+
+	sent bool
+	res  *http.Response
+	data []byte
+	err  error
+}
+
+type testFile struct {
+	field, name string
+	content     []byte
+}
+
+// Header set a request header
+func (r *TestRequest) Header(key, value string) *TestRequest {
+	r.header.Set(key, value)
+	return r
+}
+
+// Query add a query argument
+func (r *TestRequest) Query(key, value string) *TestRequest {
+	r.query.Add(key, value)
+	return r
+}
+
+// Cookie add a cookie to the request, the cookies of the jar are sent too
+func (r *TestRequest) Cookie(name, value string) *TestRequest {
+	r.cookies = append(r.cookies, &http.Cookie{Name: name, Value: value})
+	return r
+}
+
+// Field add a form field, the form is sent urlencoded
+// or as multipart when files are added
+func (r *TestRequest) Field(key, value string) *TestRequest {
+	r.form.Add(key, value)
+	return r
+}
+
+// File add a multipart file upload
+func (r *TestRequest) File(field, filename string, content []byte) *TestRequest {
+	r.files = append(r.files, testFile{field, filename, content})
+	return r
+}
+
+// Body set the raw request body, string, []byte or io.Reader
+func (r *TestRequest) Body(body interface{}) *TestRequest {
+	switch b := body.(type) {
+	case string:
+		r.body = strings.NewReader(b)
+	case []byte:
+		r.body = bytes.NewReader(b)
+	case io.Reader:
+		r.body = b
+	default:
+		r.err = fmt.Errorf("test: body type %T not supported", body)
+	}
+	return r
+}
+
+// JSONBody set the body to v encoded as json
+func (r *TestRequest) JSONBody(v interface{}) *TestRequest {
+	b, err := json.Marshal(v)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	r.header.Set(HeaderContentType, MIMEApplicationJSONCharsetUTF8)
+	r.body = bytes.NewReader(b)
+	return r
+}
+
+// Expect check the response status code
+func (r *TestRequest) Expect(status int) *TestRequest {
+	if r.send(); r.err == nil && r.res.StatusCode != status {
+		r.err = fmt.Errorf("test: %s %s status %d, expected %d: %s", r.method, r.path, r.res.StatusCode, status, r.data)
+	}
+	return r
+}
+
+// ExpectHeader check a response header
+func (r *TestRequest) ExpectHeader(key, value string) *TestRequest {
+	if r.send(); r.err == nil && r.res.Header.Get(key) != value {
+		r.err = fmt.Errorf("test: %s %s header %s %q, expected %q", r.method, r.path, key, r.res.Header.Get(key), value)
+	}
+	return r
+}
+
+// Err returns the first error of the request
+func (r *TestRequest) Err() error {
+	r.send()
+	return r.err
+}
+
+// Response returns the response, the body is already read and returned by Bytes
+func (r *TestRequest) Response() (*http.Response, error) {
+	r.send()
+	return r.res, r.err
+}
+
+// Bytes returns the response body
+func (r *TestRequest) Bytes() ([]byte, error) {
+	r.send()
+	return r.data, r.err
+}
+
+// String returns the response body as string
+func (r *TestRequest) String() (string, error) {
+	r.send()
+	return string(r.data), r.err
+}
+
+// JSON decode the response body into out
+func (r *TestRequest) JSON(out interface{}) error {
+	if r.send(); r.err != nil {
+		return r.err
+	}
+	return json.Unmarshal(r.data, out)
+}
+
+// send the request once
+func (r *TestRequest) send() {
+	if r.sent || r.err != nil {
+		return
+	}
+	r.sent = true
+
+	u, err := url.Parse("http://cola.test" + r.path)
+	if err != nil {
+		r.err = err
+		return
+	}
+	if len(r.query) > 0 {
+		q := u.Query()
+		for k, v := range r.query {
+			q[k] = append(q[k], v...)
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	body, contentType, err := r.encodeBody()
+	if err != nil {
+		r.err = err
+		return
+	}
+
+	req, err := http.NewRequest(r.method, u.String(), body)
+	if err != nil {
+		r.err = err
+		return
+	}
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	if contentType != "" {
+		req.Header.Set(HeaderContentType, contentType)
+	}
+	for _, cookie := range r.client.jar.Cookies(u) {
+		req.AddCookie(cookie)
+	}
+	for _, cookie := range r.cookies {
+		req.AddCookie(cookie)
+	}
+
+	if r.res, r.err = r.client.core.Test(req, r.client.Timeout); r.err != nil {
+		return
+	}
+	defer r.res.Body.Close()
+	r.data, r.err = ioutil.ReadAll(r.res.Body)
+	r.client.jar.SetCookies(u, r.res.Cookies())
+}
+
+// encodeBody returns the body and its content type built from the fields and files
+func (r *TestRequest) encodeBody() (io.Reader, string, error) {
+	if len(r.files) == 0 {
+		if len(r.form) == 0 {
+			return r.body, "", nil
+		}
+		return strings.NewReader(r.form.Encode()), MIMEApplicationForm, nil
+	}
+
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+	for k, values := range r.form {
+		for _, v := range values {
+			if err := mw.WriteField(k, v); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	for _, f := range r.files {
+		w, err := mw.CreateFormFile(f.field, f.name)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err = w.Write(f.content); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf, mw.FormDataContentType(), nil
+}
@@ -0,0 +1,219 @@
+package cola
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testClientHandler struct {
+	Handler
+}
+
+func (h *testClientHandler) Preload(c *Ctx) {
+	c.Vars("user", "bob")
+	c.Next()
+}
+
+// GetUserParam GET /user/:param
+func (h *testClientHandler) GetUserParam(c *Ctx) {
+	c.SendString(c.Vars("user").(string) + ":" + c.Params("param"))
+}
+
+// PostSave POST /save
+func (h *testClientHandler) PostSave(c *Ctx) error {
+	return c.SendString("saved " + c.FormValue("name"))
+}
+
+func TestCoreTest(t *testing.T) {
+	app := New()
+	app.Use(new(testClientHandler))
+	app.Add(MethodGet, "/slow", func(c *Ctx) {
+		time.Sleep(200 * time.Millisecond)
+	})
+
+	res, err := app.Test(httptest.NewRequest(MethodGet, "/user/5", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != StatusOK || string(body) != "bob:5" {
+		t.Fatalf("GET /user/5 = %d %q", res.StatusCode, body)
+	}
+
+	if _, err = app.Test(httptest.NewRequest(MethodGet, "/slow", nil), 50*time.Millisecond); err == nil {
+		t.Fatal("Test() of a slow handler returns no timeout error")
+	}
+}
+
+func TestTestClientHandler(t *testing.T) {
+	app := New()
+	app.Use(new(testClientHandler))
+	tc := NewTestClient(app)
+
+	for _, tt := range []struct {
+		req  *TestRequest
+		body string
+	}{
+		{tc.Get("/user/7"), "bob:7"},
+		{tc.Post("/save").Field("name", "a b"), "saved a b"},
+		{tc.Post("/save").Body("name=c").Header(HeaderContentType, MIMEApplicationForm), "saved c"},
+	} {
+		body, err := tt.req.Expect(StatusOK).String()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if body != tt.body {
+			t.Errorf("body = %q, want %q", body, tt.body)
+		}
+	}
+	if err := tc.Get("/save").Expect(StatusMethodNotAllowed).ExpectHeader(HeaderAllow, MethodPost).Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTestClientStatic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cola-static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"hello.txt":      "hello",
+		"index.html":     "<p>index</p>",
+		"css/app.css":    "body{}",
+		"../secret.conf": "secret",
+	} {
+		name = filepath.Join(dir, "public", name)
+		os.MkdirAll(filepath.Dir(name), 0755)
+		if err = ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app := New()
+	app.Static("/static", filepath.Join(dir, "public"))
+	// the file server logs the missing files
+	app.Server.Logger = log.New(ioutil.Discard, "", 0)
+	tc := NewTestClient(app)
+
+	for _, tt := range []struct {
+		path        string
+		status      int
+		body        string
+		contentType string
+	}{
+		{"/static/hello.txt", StatusOK, "hello", MIMETextPlainCharsetUTF8},
+		{"/static/css/app.css", StatusOK, "body{}", "text/css; charset=utf-8"},
+		{"/static", StatusOK, "<p>index</p>", MIMETextHTMLCharsetUTF8},
+		{"/static/missing.txt", StatusNotFound, "", ""},
+		{"/static/../secret.conf", StatusNotFound, "", ""},
+	} {
+		req := tc.Get(tt.path).Expect(tt.status)
+		if tt.status == StatusOK {
+			req.ExpectHeader(HeaderContentType, tt.contentType)
+		}
+		body, err := req.String()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if tt.status == StatusOK && body != tt.body {
+			t.Errorf("GET %s = %q, want %q", tt.path, body, tt.body)
+		}
+	}
+	if err = tc.Request(MethodHead, "/static/hello.txt").Expect(StatusOK).ExpectHeader(HeaderContentLength, "5").Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTestClientCookies(t *testing.T) {
+	app := New()
+	app.Add(MethodPost, "/login", func(c *Ctx) {
+		c.Cookie(&Cookie{Name: "token", Value: c.FormValue("user"), Path: "/", HTTPOnly: true})
+	})
+	app.Add(MethodGet, "/me", func(c *Ctx) {
+		c.SendString(c.Cookies("token", "guest") + "|" + c.Cookies("lang"))
+	})
+	app.Add(MethodPost, "/logout", func(c *Ctx) { c.ClearCookies("token") })
+	tc := NewTestClient(app)
+
+	for _, tt := range []struct {
+		req  *TestRequest
+		body string
+	}{
+		{tc.Get("/me"), "guest|"},
+		{tc.Post("/login").Field("user", "bob"), ""},
+		// the jar sends the cookie back
+		{tc.Get("/me"), "bob|"},
+		{tc.Get("/me").Cookie("lang", "en"), "bob|en"},
+		// another client has its own jar
+		{NewTestClient(app).Get("/me"), "guest|"},
+		{tc.Post("/logout"), ""},
+		{tc.Get("/me"), "guest|"},
+	} {
+		body, err := tt.req.Expect(StatusOK).String()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if body != tt.body {
+			t.Errorf("%s %s = %q, want %q", tt.req.method, tt.req.path, body, tt.body)
+		}
+	}
+}
+
+func TestTestClientUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cola-upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	app := New()
+	app.Add(MethodPost, "/upload", func(c *Ctx) error {
+		form, err := c.MultipartForm()
+		if err != nil {
+			return err
+		}
+		var names []string
+		for _, fh := range form.File["files"] {
+			if err = c.SaveFile(fh, filepath.Join(dir, fh.Filename)); err != nil {
+				return err
+			}
+			names = append(names, fh.Filename+"="+strconv.FormatInt(fh.Size, 10))
+		}
+		return c.SendString(c.FormValue("title") + " " + strings.Join(names, ","))
+	})
+	tc := NewTestClient(app)
+
+	big := bytes.Repeat([]byte("x"), 64*1024)
+	body, err := tc.Post("/upload").Field("title", "docs").
+		File("files", "a.txt", []byte("alpha")).File("files", "b.bin", big).
+		Expect(StatusOK).String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "docs a.txt=5,b.bin=65536"; body != want {
+		t.Fatalf("body = %q, want %q", body, want)
+	}
+	for name, want := range map[string][]byte{"a.txt": []byte("alpha"), "b.bin": big} {
+		if got, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("saved %s = %d bytes, %v", name, len(got), err)
+		}
+	}
+
+	// a request without a multipart body
+	if err = tc.Post("/upload").Field("title", "x").Expect(StatusInternalServerError).Err(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,113 @@
+package cola
+
+import "strings"
+
+// node is a node of the compressed radix tree used by the router.
+//
+// Routes are indexed by the constant prefix of their path (everything
+// before the first parameter), so a lookup only walks the characters
+// of the request path and collects the routes stored on the way.
+// The collected routes are still checked with Route.match, this keeps
+// the full ':param', ':param?', '*' and '+' syntax of parseRoute.
+type node struct {
+	prefix   string   // compressed path part of this node
+	indices  string   // first byte of the prefix of every child
+	children []*node  // child nodes, same order as indices
+	routes   []*Route // routes ending on this node, sorted by pos
+}
+
+// insert adds the route under the given key, splitting nodes when needed
+func (n *node) insert(key string, route *Route) {
+	for {
+		// Find the longest common prefix
+		i := 0
+		max := len(key)
+		if len(n.prefix) < max {
+			max = len(n.prefix)
+		}
+		for i < max && key[i] == n.prefix[i] {
+			i++
+		}
+
+		// Split the node, the current node keeps the common prefix
+		if i < len(n.prefix) {
+			child := &node{
+				prefix:   n.prefix[i:],
+				indices:  n.indices,
+				children: n.children,
+				routes:   n.routes,
+			}
+			n.prefix = n.prefix[:i]
+			n.indices = string(child.prefix[0])
+			n.children = []*node{child}
+			n.routes = nil
+		}
+
+		key = key[i:]
+		if len(key) == 0 {
+			n.routes = append(n.routes, route)
+			return
+		}
+
+		// Walk down to the child with the same first byte
+		if idx := strings.IndexByte(n.indices, key[0]); idx != -1 {
+			n = n.children[idx]
+			continue
+		}
+
+		n.indices += string(key[0])
+		n.children = append(n.children, &node{prefix: key, routes: []*Route{route}})
+		return
+	}
+}
+
+// find appends all routes which keys are a prefix of path to dst,
+// the result is sorted by the route position.
+func (n *node) find(path string, dst []*Route) []*Route {
+	for n != nil {
+		if !strings.HasPrefix(path, n.prefix) {
+			break
+		}
+		path = path[len(n.prefix):]
+		dst = mergeRoutes(dst, n.routes)
+		if len(path) == 0 {
+			break
+		}
+		idx := strings.IndexByte(n.indices, path[0])
+		if idx == -1 {
+			break
+		}
+		n = n.children[idx]
+	}
+	return dst
+}
+
+// mergeRoutes inserts the sorted routes into the sorted dst keeping the position order
+func mergeRoutes(dst, routes []*Route) []*Route {
+	for _, route := range routes {
+		dst = append(dst, route)
+		i := len(dst) - 1
+		for i > 0 && dst[i-1].pos > route.pos {
+			dst[i] = dst[i-1]
+			i--
+		}
+		dst[i] = route
+	}
+	return dst
+}
+
+// treeKey returns the constant prefix of the route used as key in the tree
+func (r *Route) treeKey() string {
+	if len(r.routeParser.segs) == 0 {
+		return r.path
+	}
+	seg := r.routeParser.segs[0]
+	if seg.IsParam {
+		return ""
+	}
+	// the slash is optional, "/user/:id?" also matches "/user"
+	if seg.HasOptionalSlash {
+		return seg.Const[:len(seg.Const)-1]
+	}
+	return seg.Const
+}
@@ -0,0 +1,91 @@
+package cola
+
+import "reflect"
+
+var (
+	ctxType   = reflect.TypeOf((*Ctx)(nil))
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// typedHand wraps a typed handler into a Hand, the supported shapes are
+//
+//	func(*Ctx, *In) (Out, error)
+//	func(*Ctx, *In) error
+//	func(*Ctx) (Out, error)
+//
+// In must be a struct, it is filled by Ctx.Bind which also validates it.
+// Out is sent by Ctx.Format in the same format as Ctx.ToJSON, a nil Out is not sent when the handler
+// already wrote the response. Errors are passed to the ErrorHandler.
+//
+//	func (h *User) PostSave(c *cola.Ctx, in *SaveUser) (*User, error)
+func typedHand(fn interface{}) (Hand, bool) {
+	v := reflect.ValueOf(fn)
+	if !v.IsValid() {
+		return nil, false
+	}
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.IsVariadic() {
+		return nil, false
+	}
+
+	switch t.NumIn() {
+	case 1:
+	case 2:
+		if in := t.In(1); in.Kind() != reflect.Ptr || in.Elem().Kind() != reflect.Struct {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	if t.In(0) != ctxType {
+		return nil, false
+	}
+
+	switch t.NumOut() {
+	case 1, 2:
+		if t.Out(t.NumOut()-1) != errorType {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	var inType reflect.Type
+	if t.NumIn() == 2 {
+		inType = t.In(1).Elem()
+		// unknown validation rules panic at registration
+		structRules(inType)
+	}
+	hasOut := t.NumOut() == 2
+
+	return HandErr(func(c *Ctx) error {
+		args := []reflect.Value{reflect.ValueOf(c)}
+		if inType != nil {
+			in := reflect.New(inType)
+			if err := c.Bind(in.Interface()); err != nil {
+				return err
+			}
+			args = append(args, in)
+		}
+
+		out := v.Call(args)
+		if err := out[len(out)-1]; !err.IsNil() {
+			return err.Interface().(error)
+		}
+		if !hasOut {
+			return nil
+		}
+		if isNilValue(out[0]) && (c.Response.IsBodyStream() || len(c.Response.Body()) > 0) {
+			return nil
+		}
+		return c.Format(result(out[0].Interface(), nil))
+	}).Hand(), true
+}
+
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package cola
+
+import "testing"
+
+type typedHandler struct {
+	Handler
+}
+
+type typedIn struct {
+	ID   int    `param:"id"`
+	Name string `json:"name" validate:"required"`
+}
+
+type typedID struct {
+	ID int `param:"id"`
+}
+
+type typedOut struct {
+	Hello string `json:"hello"`
+}
+
+func (h *typedHandler) PostUser(c *Ctx, in *typedIn) (*typedOut, error) {
+	return &typedOut{Hello: in.Name}, nil
+}
+
+func (h *typedHandler) GetAny(c *Ctx) (interface{}, error) { return Map{"a": 1}, nil }
+
+func (h *typedHandler) GetFail(c *Ctx) (interface{}, error) { return nil, ErrForbidden }
+
+func (h *typedHandler) GetRaw(c *Ctx) (*typedOut, error) {
+	c.SendString("raw")
+	return nil, nil
+}
+
+func (h *typedHandler) DeleteUser(c *Ctx, in *typedIn) error { return nil }
+
+func TestTypedHandlers(t *testing.T) {
+	app := New()
+	app.Use(new(typedHandler))
+	app.Add(MethodGet, "/id/:id", func(c *Ctx, in *typedID) (int, error) {
+		return in.ID, nil
+	})
+	tc := NewTestClient(app)
+
+	for _, tt := range []struct {
+		req    *TestRequest
+		status int
+		body   string
+	}{
+		{tc.Post("/user").JSONBody(Map{"name": "bob"}), StatusOK, `{"msg":"ok","result":{"hello":"bob"},"status":true}`},
+		{tc.Post("/user"), StatusUnprocessableEntity, `{"errors":{"name":"is required"},"msg":"name is required","result":null,"status":false}`},
+		{tc.Get("/any"), StatusOK, `{"msg":"ok","result":{"a":1},"status":true}`},
+		{tc.Get("/fail"), StatusForbidden, `{"msg":"Forbidden","result":null,"status":false}`},
+		{tc.Get("/raw"), StatusOK, "raw"},
+		{tc.Delete("/user").JSONBody(Map{"name": "bob"}), StatusOK, ""},
+		{tc.Get("/id/5"), StatusOK, `{"msg":"ok","result":5,"status":true}`},
+		{tc.Get("/id/x"), StatusBadRequest, ""},
+	} {
+		body, err := tt.req.Expect(tt.status).String()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if tt.body != "" && body != tt.body {
+			t.Errorf("body = %s, want %s", body, tt.body)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package cola
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/xs23933/uid"
+)
+
+// ValidationFunc checks the value of a field, param is the text after '=' in the rule.
+// The value is never a pointer, nil pointers are only checked by required.
+type ValidationFunc func(value reflect.Value, param string) bool
+
+// FieldError a failed rule of a field
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationError the failed rules returned by Validate,
+// the error handler and ToJSON send it as 422 with the errors of every field
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// Error makes it compatible with the `error` interface.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Field+" "+fe.Message)
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// Map returns the message of the first failed rule of every field
+func (e *ValidationError) Map() map[string]string {
+	m := make(map[string]string, len(e.Errors))
+	for _, fe := range e.Errors {
+		if _, ok := m[fe.Field]; !ok {
+			m[fe.Field] = fe.Message
+		}
+	}
+	return m
+}
+
+type validation struct {
+	fn      ValidationFunc
+	message string // fmt format with the rule param
+}
+
+var (
+	validations   = make(map[string]validation)
+	validationsMu sync.RWMutex
+	// rules of struct types
+	validateCache sync.Map
+)
+
+// RegisterValidation register a rule used by the validate tag,
+// message is a fmt format which gets the rule param.
+//
+//	cola.RegisterValidation("prefix", func(v reflect.Value, param string) bool {
+//		return strings.HasPrefix(v.String(), param)
+//	}, "must start with %s")
+func RegisterValidation(name string, fn ValidationFunc, message ...string) {
+	msg := "failed on " + name
+	if len(message) > 0 {
+		msg = message[0]
+	}
+	validationsMu.Lock()
+	validations[name] = validation{fn, msg}
+	validationsMu.Unlock()
+}
+
+type fieldRule struct {
+	name  string
+	param string
+}
+
+type fieldRules struct {
+	index     int
+	name      string // name used in the errors
+	omitempty bool
+	required  bool
+	rules     []fieldRule
+	dive      bool // struct or slice of structs validated recursively
+}
+
+// Validate checks the struct fields with the rules of the validate tag,
+// Bind calls it after the request is decoded.
+// It returns a *ValidationError with every failed rule.
+//
+//	type User struct {
+//		Name  string `json:"name" validate:"required,min=3,max=64"`
+//		Email string `json:"email" validate:"omitempty,email"`
+//		Role  string `json:"role" validate:"oneof=admin user"`
+//	}
+//
+// Built-in rules: required omitempty min max len email url alpha numeric oneof uuid uid,
+// min max len compare the number or the length of strings, slices and maps.
+// Nested structs are validated and the fields named parent.field.
+func Validate(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	ve := &ValidationError{}
+	validateStruct(rv, "", ve)
+	if len(ve.Errors) == 0 {
+		return nil
+	}
+	return ve
+}
+
+func validateStruct(rv reflect.Value, prefix string, ve *ValidationError) {
+	for _, fr := range structRules(rv.Type()) {
+		field := rv.Field(fr.index)
+		name := prefix + fr.name
+
+		if isEmptyValue(field) {
+			if fr.required {
+				ve.Errors = append(ve.Errors, FieldError{Field: name, Rule: "required", Message: "is required"})
+			}
+			if fr.required || fr.omitempty {
+				continue
+			}
+		}
+
+		for field.Kind() == reflect.Ptr && !field.IsNil() {
+			field = field.Elem()
+		}
+		if field.Kind() == reflect.Ptr {
+			continue
+		}
+
+		for _, r := range fr.rules {
+			validationsMu.RLock()
+			val := validations[r.name]
+			validationsMu.RUnlock()
+			if !val.fn(field, r.param) {
+				msg := val.message
+				if strings.Contains(msg, "%") {
+					msg = fmt.Sprintf(msg, r.param)
+				}
+				ve.Errors = append(ve.Errors, FieldError{Field: name, Rule: r.name, Param: r.param, Message: msg})
+			}
+		}
+
+		if !fr.dive {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.Struct:
+			validateStruct(field, name+".", ve)
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < field.Len(); i++ {
+				item := field.Index(i)
+				for item.Kind() == reflect.Ptr && !item.IsNil() {
+					item = item.Elem()
+				}
+				if item.Kind() == reflect.Struct {
+					validateStruct(item, name+"["+strconv.Itoa(i)+"].", ve)
+				}
+			}
+		}
+	}
+}
+
+// structRules returns the cached rules of the fields of t,
+// it panics on a rule which is not registered
+func structRules(t reflect.Type) []fieldRules {
+	if rules, ok := validateCache.Load(t); ok {
+		return rules.([]fieldRules)
+	}
+	return parseRules(t, make(map[reflect.Type]bool))
+}
+
+// parseRules parses the rules of t, parsing holds the struct types being parsed
+func parseRules(t reflect.Type, parsing map[reflect.Type]bool) []fieldRules {
+	if rules, ok := validateCache.Load(t); ok {
+		return rules.([]fieldRules)
+	}
+	parsing[t] = true
+	rules := make([]fieldRules, 0)
+	// rules only made of fields of type t, which has then no rules
+	selfOnly := true
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		fr := fieldRules{index: i, name: fieldName(f)}
+		tag := f.Tag.Get("validate")
+		if tag == "-" {
+			continue
+		}
+		for _, rule := range strings.Split(tag, ",") {
+			rule = strings.TrimSpace(rule)
+			switch {
+			case rule == "":
+			case rule == "required":
+				fr.required = true
+			case rule == "omitempty":
+				fr.omitempty = true
+			default:
+				r := fieldRule{name: rule}
+				if i := strings.IndexByte(rule, '='); i != -1 {
+					r.name, r.param = rule[:i], rule[i+1:]
+				}
+				validationsMu.RLock()
+				_, ok := validations[r.name]
+				validationsMu.RUnlock()
+				if !ok {
+					panic(fmt.Sprintf("cola: unknown validation rule %q of field %s.%s", r.name, t.Name(), f.Name))
+				}
+				fr.rules = append(fr.rules, r)
+			}
+		}
+		fr.dive = hasRules(f.Type, parsing)
+		if tag == "" && !fr.dive {
+			continue
+		}
+		if tag != "" || elemType(f.Type) != t {
+			selfOnly = false
+		}
+		rules = append(rules, fr)
+	}
+	if selfOnly {
+		rules = rules[:0]
+	}
+	delete(parsing, t)
+	validateCache.Store(t, rules)
+	return rules
+}
+
+// hasRules reports whether t is a struct, or a slice of structs, with validate tags.
+// A struct being parsed refers to itself, its rules are not known yet so it is walked.
+func hasRules(t reflect.Type, parsing map[reflect.Type]bool) bool {
+	t = elemType(t)
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	if parsing[t] {
+		return true
+	}
+	return len(parseRules(t, parsing)) > 0
+}
+
+// elemType returns the type of the elements of pointers, slices and arrays
+func elemType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	return t
+}
+
+// fieldName returns the name of the field used in the errors,
+// the json, form, query or param tag, or the field name
+func fieldName(f reflect.StructField) string {
+	for _, tag := range []string{"json", "form", "query", "param"} {
+		if name := strings.Split(f.Tag.Get(tag), ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// size returns the number of v, or the length of strings, slices and maps
+func size(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true
+	}
+	return 0, false
+}
+
+func compareSize(cmp func(a, b float64) bool) ValidationFunc {
+	return func(v reflect.Value, param string) bool {
+		n, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return false
+		}
+		s, ok := size(v)
+		return ok && cmp(s, n)
+	}
+}
+
+func matchString(fn func(string) bool) ValidationFunc {
+	return func(v reflect.Value, _ string) bool {
+		return v.Kind() == reflect.String && fn(v.String())
+	}
+}
+
+var (
+	emailRegexp = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
+	urlRegexp   = regexp.MustCompile(`^https?://[^\s/$.?#][^\s]*$`)
+	uidType     = reflect.TypeOf(uid.UID{})
+)
+
+func init() {
+	RegisterValidation("min", compareSize(func(a, b float64) bool { return a >= b }), "must be at least %s")
+	RegisterValidation("max", compareSize(func(a, b float64) bool { return a <= b }), "must be at most %s")
+	RegisterValidation("len", compareSize(func(a, b float64) bool { return a == b }), "must be %s long")
+	RegisterValidation("email", matchString(emailRegexp.MatchString), "must be a valid email")
+	RegisterValidation("url", matchString(urlRegexp.MatchString), "must be a valid url")
+	RegisterValidation("alpha", matchString(isAlpha), "must contain only letters")
+	RegisterValidation("numeric", matchString(isNumeric), "must be numeric")
+	RegisterValidation("uuid", matchString(isUUID), "must be a valid uuid")
+	RegisterValidation("oneof", func(v reflect.Value, param string) bool {
+		s := fmt.Sprint(v.Interface())
+		for _, opt := range strings.Fields(param) {
+			if s == opt {
+				return true
+			}
+		}
+		return false
+	}, "must be one of %s")
+	RegisterValidation("uid", func(v reflect.Value, _ string) bool {
+		if v.Type() == uidType {
+			u := v.Interface().(uid.UID)
+			return u != uid.Nil && isUID(string(u[:]))
+		}
+		return v.Kind() == reflect.String && isUID(v.String())
+	}, "must be a valid uid")
+}
+
+func isNumeric(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
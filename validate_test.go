@@ -0,0 +1,129 @@
+package cola
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xs23933/uid"
+)
+
+type validateAddr struct {
+	City string `json:"city" validate:"required"`
+}
+
+type validateUser struct {
+	ID    uid.UID        `param:"id" validate:"uid"`
+	Name  string         `json:"name" validate:"required,min=3,max=8"`
+	Email string         `json:"email" validate:"omitempty,email"`
+	Role  string         `json:"role" validate:"oneof=admin user"`
+	Age   int            `json:"age" validate:"min=18"`
+	Addr  validateAddr   `json:"addr"`
+	Items []validateAddr `json:"items"`
+	Tags  []string       `json:"tags" validate:"max=2"`
+	Code  string         `json:"code" validate:"prefix=X"`
+}
+
+func TestValidate(t *testing.T) {
+	RegisterValidation("prefix", func(v reflect.Value, param string) bool {
+		return strings.HasPrefix(v.String(), param)
+	}, "must start with %s")
+	app := New()
+	app.Add(MethodPost, "/user/:id", func(c *Ctx) error {
+		var in validateUser
+		if err := c.Bind(&in); err != nil {
+			return err
+		}
+		return c.SendString("ok")
+	})
+	tc := NewTestClient(app)
+
+	var out struct {
+		Errors map[string]string `json:"errors"`
+	}
+	err := tc.Post("/user/abc").JSONBody(Map{
+		"name": "ab", "email": "x", "role": "root", "age": 3,
+		"items": []Map{{"city": ""}}, "tags": []string{"a", "b", "c"}, "code": "Y",
+	}).Expect(StatusUnprocessableEntity).JSON(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"id":            "must be a valid uid",
+		"name":          "must be at least 3",
+		"email":         "must be a valid email",
+		"role":          "must be one of admin user",
+		"age":           "must be at least 18",
+		"addr.city":     "is required",
+		"items[0].city": "is required",
+		"tags":          "must be at most 2",
+		"code":          "must start with X",
+	}
+	if !reflect.DeepEqual(out.Errors, want) {
+		t.Fatalf("errors = %v, want %v", out.Errors, want)
+	}
+
+	err = tc.Post("/user/ABCDEFGHIJKL").JSONBody(Map{
+		"name": "abcd", "role": "user", "age": 20, "addr": Map{"city": "x"}, "code": "Xa",
+	}).Expect(StatusOK).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type validateCat struct {
+	Name     string        `json:"name" validate:"required"`
+	Children []validateCat `json:"children"`
+	Parent   *validateCat  `json:"parent"`
+}
+
+func TestValidateRecursiveStruct(t *testing.T) {
+	if err := Validate(&validateCat{Name: "a"}); err != nil {
+		t.Fatalf("Validate() = %v, want nil", err)
+	}
+
+	cat := &validateCat{Name: "a", Children: []validateCat{{Name: "b"}, {}}}
+	err := Validate(cat)
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("Validate() = %v, want *ValidationError", err)
+	}
+	if len(ve.Errors) != 1 || ve.Errors[0].Field != "children[1].name" {
+		t.Fatalf("errors = %+v, want children[1].name", ve.Errors)
+	}
+}
+
+type validateNode struct {
+	Next *validateNode
+}
+
+func TestValidateRecursiveStructWithoutRules(t *testing.T) {
+	n := &validateNode{}
+	n.Next = n
+	if err := Validate(n); err != nil {
+		t.Fatalf("Validate() = %v, want nil", err)
+	}
+}
+
+type validateUnknown struct {
+	Name string `validate:"required,nosuchrule"`
+}
+
+func TestValidateUnknownRule(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("Validate() did not panic on an unknown rule")
+		}
+	}()
+	_ = Validate(&validateUnknown{Name: "a"})
+}
+
+func TestTypedHandUnknownRule(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("typedHand() did not panic on an unknown rule")
+		}
+	}()
+	typedHand(func(c *Ctx, in *validateUnknown) error { return nil })
+}
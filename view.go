@@ -317,6 +317,14 @@ var templateHelpers = template.FuncMap{
 	"dump": func(src interface{}) interface{} {
 		return spew.Sdump(src)
 	},
+	// url generate the path of a named route, bound to Core.URL by the core
+	"url": func(name string, params ...interface{}) (string, error) {
+		return "", fmt.Errorf("url: views not bound to a cola core")
+	},
+	// csrfField renders the hidden input of the token set by the CSRF middleware
+	"csrfField": csrfField,
+	// flashes returns and removes the flash messages of the session bound by Render
+	"flashes": templateFlashes,
 	// 设置默认值
 	"default": func(src, def interface{}) interface{} {
 		if src != nil {
@@ -0,0 +1,528 @@
+package cola
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WS config of websocket routes
+type WS struct {
+	// Maximum size of a message read from the client,
+	// bigger messages close the connection with 1009.
+	// Optional. Default value 1MB.
+	ReadLimit int64 `json:"read_limit"`
+
+	// Interval of the ping messages sent to the client.
+	// Use a negative time.Duration to disable it.
+	//
+	// Optional. Default value 30 * time.Second.
+	PingInterval time.Duration `json:"ping_interval"`
+
+	// Time to wait for the next message or pong from the client.
+	// Use a negative time.Duration to disable it.
+	//
+	// Optional. Default value 60 * time.Second.
+	PongWait time.Duration `json:"pong_wait"`
+
+	// Maximum duration of a write.
+	// Optional. Default value 10 * time.Second.
+	WriteTimeout time.Duration `json:"write_timeout"`
+
+	// Size of the read buffer.
+	// Optional. Default value 4096.
+	ReadBufferSize int `json:"read_buffer_size"`
+
+	// Supported subprotocols, the first one requested by the client is used.
+	// Optional. Default value nil.
+	Subprotocols []string `json:"subprotocols"`
+
+	// CheckOrigin returns true to accept the request.
+	// Optional. Default accepts requests without Origin or with the same host.
+	CheckOrigin func(*Ctx) bool `json:"-"`
+}
+
+// Websocket message types
+const (
+	WSTextMessage   = 1
+	WSBinaryMessage = 2
+	WSCloseMessage  = 8
+	WSPingMessage   = 9
+	WSPongMessage   = 10
+)
+
+// Websocket close codes
+const (
+	WSCloseNormal         = 1000
+	WSCloseGoingAway      = 1001
+	WSCloseProtocolError  = 1002
+	WSCloseNoStatus       = 1005
+	WSCloseInvalidPayload = 1007
+	WSCloseMessageTooBig  = 1009
+	WSCloseInternalError  = 1011
+)
+
+const (
+	wsContinuation         = 0
+	wsGUID                 = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsMaxControlPayload    = 125
+	wsDefaultReadLimit     = 1 << 20
+	wsDefaultPingInterval  = 30 * time.Second
+	wsDefaultPongWait      = 60 * time.Second
+	wsDefaultWriteTimeout  = 10 * time.Second
+	wsDefaultReadBufferLen = 4096
+)
+
+var (
+	// ErrWSClosed is returned when using a closed connection
+	ErrWSClosed = errors.New("websocket: connection closed")
+	// ErrWSReadLimit is returned when a message exceeds WS.ReadLimit
+	ErrWSReadLimit = errors.New("websocket: read limit exceeded")
+)
+
+// WSCloseError is returned by ReadMessage when the client closed the connection
+type WSCloseError struct {
+	Code int
+	Text string
+}
+
+// Error makes it compatible with the `error` interface.
+func (e *WSCloseError) Error() string {
+	return "websocket: close " + strconv.Itoa(e.Code) + " " + e.Text
+}
+
+// WSConn a websocket connection, the Vars and Params of the request
+// are copied before the upgrade as the Ctx is released.
+// One goroutine may read while others write, writes are serialized.
+type WSConn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	config      WS
+	subprotocol string
+	vars        map[string]interface{}
+	params      map[string]string
+
+	wmu       sync.Mutex // serializes the writes
+	closeOnce sync.Once
+	closeSent bool
+	done      chan struct{}
+}
+
+// WS register a websocket route, the USE middleware and the group
+// middleware run before the upgrade so auth still applies.
+//
+//	app.WS("/chat", func(conn *cola.WSConn) {
+//		for {
+//			var msg Message
+//			if err := conn.ReadJSON(&msg); err != nil {
+//				return
+//			}
+//			conn.WriteJSON(msg)
+//		}
+//	})
+func (c *Core) WS(path string, fn func(*WSConn), config ...WS) *Core {
+	return c.Add(MethodGet, path, wsHand(fn, config...))
+}
+
+// WS register a websocket route below the group prefix
+func (g *Group) WS(path string, fn func(*WSConn), config ...WS) *Group {
+	return g.Add(MethodGet, path, wsHand(fn, config...))
+}
+
+// wsHand returns the handler which upgrades the request and runs fn
+func wsHand(fn func(*WSConn), config ...WS) Hand {
+	cfg := WS{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.ReadLimit <= 0 {
+		cfg.ReadLimit = wsDefaultReadLimit
+	}
+	if cfg.PingInterval == 0 {
+		cfg.PingInterval = wsDefaultPingInterval
+	}
+	if cfg.PongWait == 0 {
+		cfg.PongWait = wsDefaultPongWait
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = wsDefaultWriteTimeout
+	}
+	if cfg.ReadBufferSize <= 0 {
+		cfg.ReadBufferSize = wsDefaultReadBufferLen
+	}
+	return HandErr(func(c *Ctx) error {
+		return c.upgrade(fn, cfg)
+	}).Hand()
+}
+
+// IsWebSocket returns true if the request asks for a websocket upgrade
+func (c *Ctx) IsWebSocket() bool {
+	return c.IsGet() &&
+		headerHasToken(c.Get(HeaderConnection), "upgrade") &&
+		strings.EqualFold(c.Get(HeaderUpgrade), "websocket")
+}
+
+// upgrade answers the websocket handshake and hijacks the connection
+func (c *Ctx) upgrade(fn func(*WSConn), cfg WS) error {
+	if !c.IsWebSocket() {
+		c.Set(HeaderSecWebSocketVersion, "13")
+		return ErrUpgradeRequired
+	}
+	if c.Get(HeaderSecWebSocketVersion) != "13" {
+		c.Set(HeaderSecWebSocketVersion, "13")
+		return NewError(StatusBadRequest, "websocket: unsupported version")
+	}
+	key := c.Get(HeaderSecWebSocketKey)
+	if k, err := base64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+		return NewError(StatusBadRequest, "websocket: invalid "+HeaderSecWebSocketKey)
+	}
+	checkOrigin := cfg.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(c) {
+		return NewError(StatusForbidden, "websocket: origin not allowed")
+	}
+
+	ws := &WSConn{
+		config:      cfg,
+		subprotocol: selectSubprotocol(c.Get(HeaderSecWebSocketProtocol), cfg.Subprotocols),
+		vars:        make(map[string]interface{}),
+		params:      make(map[string]string),
+		done:        make(chan struct{}),
+	}
+	c.VisitUserValues(func(k []byte, v interface{}) {
+		ws.vars[string(k)] = v
+	})
+	for i, key := range c.route.Params {
+		if i < len(c.values) {
+			ws.params[key] = CopyString(c.values[i])
+		}
+	}
+
+	c.Status(StatusSwitchingProtocols)
+	c.Set(HeaderUpgrade, "websocket")
+	c.Set(HeaderConnection, "Upgrade")
+	c.Set(HeaderSecWebSocketAccept, wsAccept(key))
+	if ws.subprotocol != "" {
+		c.Set(HeaderSecWebSocketProtocol, ws.subprotocol)
+	}
+
+	c.Hijack(func(conn net.Conn) {
+		ws.conn = conn
+		ws.br = bufio.NewReaderSize(conn, cfg.ReadBufferSize)
+		defer ws.Close()
+		if cfg.PingInterval > 0 {
+			go ws.keepalive()
+		}
+		ws.extendReadDeadline()
+		fn(ws)
+	})
+	return nil
+}
+
+// Vars returns the request Vars of key
+func (ws *WSConn) Vars(key string) interface{} {
+	return ws.vars[key]
+}
+
+// Params returns the route param of key
+func (ws *WSConn) Params(key string, defaultValue ...string) string {
+	return defaultString(ws.params[key], defaultValue)
+}
+
+// Subprotocol returns the negotiated subprotocol
+func (ws *WSConn) Subprotocol() string {
+	return ws.subprotocol
+}
+
+// RemoteAddr returns the remote network address
+func (ws *WSConn) RemoteAddr() net.Addr {
+	return ws.conn.RemoteAddr()
+}
+
+// Done returns a channel closed when the connection is closed
+func (ws *WSConn) Done() <-chan struct{} {
+	return ws.done
+}
+
+// ReadMessage reads the next text or binary message,
+// pings are answered and a close from the client returns a *WSCloseError
+func (ws *WSConn) ReadMessage() (messageType int, p []byte, err error) {
+	for {
+		fin, opcode, payload, err := ws.readFrame(int64(len(p)))
+		if err != nil {
+			return 0, nil, err
+		}
+		switch opcode {
+		case WSPingMessage:
+			if err = ws.writeFrame(WSPongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case WSPongMessage:
+			continue
+		case WSCloseMessage:
+			return 0, nil, ws.closeReceived(payload)
+		case wsContinuation:
+			if messageType == 0 {
+				return 0, nil, ws.fail(WSCloseProtocolError, "unexpected continuation frame")
+			}
+		case WSTextMessage, WSBinaryMessage:
+			if messageType != 0 {
+				return 0, nil, ws.fail(WSCloseProtocolError, "expected continuation frame")
+			}
+			messageType = opcode
+		default:
+			return 0, nil, ws.fail(WSCloseProtocolError, "unknown opcode")
+		}
+		p = append(p, payload...)
+		if fin {
+			if messageType == WSTextMessage && !utf8.Valid(p) {
+				return 0, nil, ws.fail(WSCloseInvalidPayload, "invalid utf-8")
+			}
+			return messageType, p, nil
+		}
+	}
+}
+
+// WriteMessage writes a text or binary message
+func (ws *WSConn) WriteMessage(messageType int, data []byte) error {
+	return ws.writeFrame(messageType, data)
+}
+
+// ReadJSON reads the next message and decodes it into v
+func (ws *WSConn) ReadJSON(v interface{}) error {
+	_, p, err := ws.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(p, v)
+}
+
+// WriteJSON writes v as a json text message
+func (ws *WSConn) WriteJSON(v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ws.writeFrame(WSTextMessage, raw)
+}
+
+// Ping sends a ping message
+func (ws *WSConn) Ping(data []byte) error {
+	return ws.writeFrame(WSPingMessage, data)
+}
+
+// Close sends a normal close message and closes the connection
+func (ws *WSConn) Close() error {
+	return ws.CloseWithCode(WSCloseNormal, "")
+}
+
+// CloseWithCode sends a close message with code and text and closes the connection
+func (ws *WSConn) CloseWithCode(code int, text string) (err error) {
+	ws.closeOnce.Do(func() {
+		_ = ws.writeClose(code, text)
+		close(ws.done)
+		err = ws.conn.Close()
+	})
+	return err
+}
+
+// readFrame reads one frame, size is the length of the message read so far
+func (ws *WSConn) readFrame(size int64) (fin bool, opcode int, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(ws.br, head[:]); err != nil {
+		return
+	}
+	ws.extendReadDeadline()
+
+	fin = head[0]&0x80 != 0
+	opcode = int(head[0] & 0x0f)
+	if head[0]&0x70 != 0 {
+		err = ws.fail(WSCloseProtocolError, "reserved bits set")
+		return
+	}
+	if head[1]&0x80 == 0 {
+		err = ws.fail(WSCloseProtocolError, "client frame not masked")
+		return
+	}
+
+	length := int64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(ws.br, ext[:]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(ws.br, ext[:]); err != nil {
+			return
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+		if length < 0 {
+			err = ws.fail(WSCloseProtocolError, "invalid length")
+			return
+		}
+	}
+
+	if opcode >= WSCloseMessage {
+		if !fin || length > wsMaxControlPayload {
+			err = ws.fail(WSCloseProtocolError, "invalid control frame")
+			return
+		}
+	} else if size+length > ws.config.ReadLimit {
+		_ = ws.CloseWithCode(WSCloseMessageTooBig, "")
+		err = ErrWSReadLimit
+		return
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(ws.br, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(ws.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i&3]
+	}
+	return
+}
+
+// writeFrame writes one unmasked frame
+func (ws *WSConn) writeFrame(opcode int, data []byte) error {
+	ws.wmu.Lock()
+	defer ws.wmu.Unlock()
+	if ws.closeSent {
+		return ErrWSClosed
+	}
+	if opcode == WSCloseMessage {
+		ws.closeSent = true
+	}
+
+	frame := make([]byte, 0, len(data)+10)
+	frame = append(frame, 0x80|byte(opcode))
+	switch n := len(data); {
+	case n <= 125:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 127)
+		frame = frame[:len(frame)+8]
+		binary.BigEndian.PutUint64(frame[len(frame)-8:], uint64(n))
+	}
+	frame = append(frame, data...)
+
+	_ = ws.conn.SetWriteDeadline(time.Now().Add(ws.config.WriteTimeout))
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+// writeClose sends a close message
+func (ws *WSConn) writeClose(code int, text string) error {
+	var payload []byte
+	if code != WSCloseNoStatus {
+		payload = make([]byte, 2, 2+len(text))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		payload = append(payload, text...)
+	}
+	return ws.writeFrame(WSCloseMessage, payload)
+}
+
+// closeReceived answers a close from the client
+func (ws *WSConn) closeReceived(payload []byte) error {
+	e := &WSCloseError{Code: WSCloseNoStatus}
+	if len(payload) >= 2 {
+		e.Code = int(binary.BigEndian.Uint16(payload))
+		e.Text = string(payload[2:])
+	}
+	_ = ws.CloseWithCode(e.Code, "")
+	return e
+}
+
+// fail closes the connection after a protocol error
+func (ws *WSConn) fail(code int, text string) error {
+	_ = ws.CloseWithCode(code, text)
+	return errors.New("websocket: " + text)
+}
+
+// keepalive sends pings until the connection is closed
+func (ws *WSConn) keepalive() {
+	ticker := time.NewTicker(ws.config.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := ws.Ping(nil); err != nil {
+				return
+			}
+		case <-ws.done:
+			return
+		}
+	}
+}
+
+func (ws *WSConn) extendReadDeadline() {
+	if ws.config.PongWait > 0 {
+		_ = ws.conn.SetReadDeadline(time.Now().Add(ws.config.PongWait))
+	}
+}
+
+// wsAccept returns the Sec-WebSocket-Accept value of key
+func wsAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// sameOrigin accepts requests without Origin or with the Origin of the same host
+func sameOrigin(c *Ctx) bool {
+	origin := c.Get(HeaderOrigin)
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, c.Hostname())
+}
+
+// selectSubprotocol returns the first protocol of the header supported by the server
+func selectSubprotocol(header string, supported []string) string {
+	for _, p := range strings.Split(header, ",") {
+		p = strings.TrimSpace(p)
+		for _, s := range supported {
+			if p == s {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// headerHasToken reports whether the comma separated header contains token
+func headerHasToken(header, token string) bool {
+	for _, t := range strings.Split(header, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
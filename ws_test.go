@@ -0,0 +1,160 @@
+package cola
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type wsHandler struct {
+	Handler
+}
+
+func (h *wsHandler) Preload(c *Ctx) {
+	if string(c.QueryArgs().Peek("token")) != "ok" {
+		c.Status(StatusUnauthorized).SendString("no")
+		return
+	}
+	c.Vars("user", "bob")
+	c.Next()
+}
+
+func (h *wsHandler) WsChat(ws *WSConn) {
+	for {
+		var m Map
+		if err := ws.ReadJSON(&m); err != nil {
+			return
+		}
+		m["user"] = ws.Vars("user")
+		ws.WriteJSON(m)
+	}
+}
+
+// wsFrame builds a masked client frame
+func wsFrame(opcode byte, data []byte) []byte {
+	f := []byte{0x80 | opcode}
+	switch n := len(data); {
+	case n <= 125:
+		f = append(f, 0x80|byte(n))
+	default:
+		f = append(f, 0x80|126, byte(n>>8), byte(n))
+	}
+	mask := []byte{1, 2, 3, 4}
+	f = append(f, mask...)
+	for i, b := range data {
+		f = append(f, b^mask[i%4])
+	}
+	return f
+}
+
+// wsRead reads an unmasked server frame
+func wsRead(br *bufio.Reader) (byte, []byte, error) {
+	h := make([]byte, 2)
+	if _, err := io.ReadFull(br, h); err != nil {
+		return 0, nil, err
+	}
+	n := int(h[1] & 0x7f)
+	if n == 126 {
+		if _, err := io.ReadFull(br, h); err != nil {
+			return 0, nil, err
+		}
+		n = int(h[0])<<8 | int(h[1])
+	}
+	p := make([]byte, n)
+	_, err := io.ReadFull(br, p)
+	return h[0] & 0xf, p, err
+}
+
+// wsDial sends the upgrade request and returns the status line
+func wsDial(t *testing.T, addr, path string) (net.Conn, *bufio.Reader, string) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", path, addr)
+	br := bufio.NewReader(conn)
+	status, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		l, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l == "\r\n" {
+			break
+		}
+		if strings.HasPrefix(strings.ToLower(l), "sec-websocket-accept:") &&
+			!strings.Contains(l, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=") {
+			t.Fatalf("bad accept header %q", l)
+		}
+	}
+	return conn, br, strings.TrimSpace(status)
+}
+
+func TestWS(t *testing.T) {
+	app := New()
+	app.Use(new(wsHandler))
+	app.WS("/echo/:room", func(ws *WSConn) {
+		for {
+			mt, p, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			ws.WriteMessage(mt, append([]byte(ws.Params("room")+":"), p...))
+		}
+	}, WS{ReadLimit: 100, PingInterval: 100 * time.Millisecond})
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// Serve builds the route tree before it listens
+	app.buildTree()
+	go app.Server.Serve(ln)
+	addr := ln.Addr().String()
+
+	if _, _, status := wsDial(t, addr, "/chat"); status != "HTTP/1.1 401 Unauthorized" {
+		t.Fatalf("upgrade without token = %q", status)
+	}
+
+	conn, br, status := wsDial(t, addr, "/chat?token=ok")
+	defer conn.Close()
+	if status != "HTTP/1.1 101 Switching Protocols" {
+		t.Fatalf("upgrade = %q", status)
+	}
+	conn.Write(wsFrame(WSTextMessage, []byte(`{"msg":"hi"}`)))
+	if op, p, err := wsRead(br); err != nil || op != WSTextMessage || string(p) != `{"msg":"hi","user":"bob"}` {
+		t.Fatalf("chat = %d %q %v", op, p, err)
+	}
+
+	conn, br, _ = wsDial(t, addr, "/echo/r1?token=ok")
+	defer conn.Close()
+	conn.Write(wsFrame(WSTextMessage, []byte("hello")))
+	if op, p, err := wsRead(br); err != nil || op != WSTextMessage || string(p) != "r1:hello" {
+		t.Fatalf("echo = %d %q %v", op, p, err)
+	}
+	if op, _, err := wsRead(br); err != nil || op != WSPingMessage {
+		t.Fatalf("keepalive = %d %v, want ping", op, err)
+	}
+	conn.Write(wsFrame(WSPingMessage, []byte("pp")))
+	if op, p, err := wsRead(br); err != nil || op != WSPongMessage || string(p) != "pp" {
+		t.Fatalf("ping = %d %q %v, want pong", op, p, err)
+	}
+	conn.Write(wsFrame(WSBinaryMessage, make([]byte, 200)))
+	op, p, err := wsRead(br)
+	if err != nil || op != WSCloseMessage || len(p) < 2 || int(p[0])<<8|int(p[1]) != WSCloseMessageTooBig {
+		t.Fatalf("read limit = %d %v %v, want close 1009", op, p, err)
+	}
+
+	if err := NewTestClient(app).Get("/echo/x").Query("token", "ok").Expect(StatusUpgradeRequired).Err(); err != nil {
+		t.Fatal(err)
+	}
+}